@@ -1,7 +1,11 @@
 package dbstorage_test
 
 import (
+	"context"
+	"database/sql"
+	"errors"
 	"math/rand"
+	"strings"
 	"testing"
 	"time"
 
@@ -24,6 +28,16 @@ type TestRow struct {
 	Birthday dbt.Time `json:"birthday" dbsorm:"1"`
 }
 
+type idRow struct {
+	ID int64
+}
+
+func (idRow) Scan(rows *sql.Rows) dbstorage.Scannable {
+	r := idRow{}
+	rows.Scan(&r.ID)
+	return r
+}
+
 func RandomString(n int) string {
 	b := make([]byte, n)
 	for i := range b {
@@ -38,23 +52,456 @@ func DoTest(t *testing.T, db dbstorage.Database) {
 
 	t.Log(db.DoesTableExist(TableName))
 	t.Log(db.QueryRowCount(TableName))
-	db.CreateTableStruct(TableName, TestRow{})
+	if err := db.CreateTableStructE(TableName, TestRow{}); err != nil {
+		t.Fatal(err)
+	}
 	t.Log(db.DoesTableExist(TableName))
 	t.Log(db.QueryColumnList(TableName))
 	t.Log(db.QueryRowCount(TableName))
 
-	for i := 0; i < 500; i++ {
-		dbstorage.InsertsLock.Lock()
-		id := db.QueryNextID(TableName)
-		nr := &TestRow{id, RandomString(12), id == 1, rand.Intn(25), dbt.Time(time.Now())}
-		db.Build().InsI(TableName, nr).Exe()
-		dbstorage.InsertsLock.Unlock()
+	// under 12 so the delete of age 12 below keeps it, later checks look for id 1
+	first := &TestRow{0, RandomString(12), true, rand.Intn(12), dbt.Time(time.Now())}
+	id, err := db.Build().InsID(TableName, first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != 1 || first.ID != id {
+		t.Fatal("expected the first generated id to be 1, got", id, first.ID)
+	}
+
+	age := first.Age
+	first.Name = "renamed"
+	first.Age = 30
+	if _, err := db.Build().UpI(TableName, first, "name").ExecE(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Build().UpINZ(TableName, &TestRow{ID: 1, Admin: true}).ExecE(); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := db.Build().Se("name, age").Fr(TableName).WhV("id", 1).ExeE()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var name string
+	var gotAge int
+	if rows.Next() {
+		rows.Scan(&name, &gotAge)
+	}
+	rows.Close()
+	if name != "renamed" || gotAge != age {
+		t.Fatal("expected UpI to only update the name, got", name, gotAge)
+	}
+
+	first.Name = "upserted"
+	if _, err := db.Build().Upsert(TableName, first, []string{"id"}, []string{"name"}).ExecE(); err != nil {
+		t.Fatal(err)
+	}
+	first.Name = "ignored"
+	if _, err := db.Build().InsIgnore(TableName, first).ExecE(); err != nil {
+		t.Fatal(err)
+	}
+	rows, err = db.Build().Se("name").Fr(TableName).WhV("id", 1).ExeE()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rows.Next() {
+		rows.Scan(&name)
+	}
+	rows.Close()
+	if name != "upserted" || db.QueryRowCount(TableName) != 1 {
+		t.Fatal("expected the upsert to update the one row and the ignored insert to do nothing, got", name)
+	}
+
+	// mysql emulates returning, which needs a transaction
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows, err = tx.Build().Up(TableName, "name", "returned").Wh("id", "1").Returning("id", "name").ExeE()
+	if err != nil {
+		t.Fatal(err)
+	}
+	id = 0
+	if rows.Next() {
+		rows.Scan(&id, &name)
+	}
+	rows.Close()
+	if id != 1 || name != "returned" {
+		t.Fatal("expected the updated row back, got", id, name)
+	}
+	rows, err = tx.Build().InsI(TableName, map[string]interface{}{"name": "temporary"}).(dbstorage.QueryBuilder).Returning("id").ExeE()
+	if err != nil {
+		t.Fatal(err)
+	}
+	id = 0
+	if rows.Next() {
+		rows.Scan(&id)
+	}
+	rows.Close()
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if id != 2 {
+		t.Fatal("expected the inserted id back, got", id)
+	}
+	if db.Dialect().Returning() {
+		rows, err = db.Build().Del(TableName).WhV("id", id).Returning("name").ExeE()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rows.Next() {
+			rows.Scan(&name)
+		}
+		rows.Close()
+		if name != "temporary" {
+			t.Fatal("expected the deleted row back, got", name)
+		}
+	} else {
+		db.Build().Del(TableName).WhV("id", id).Exe()
+	}
+
+	many := []TestRow{}
+	for i := 0; i < 499; i++ {
+		many = append(many, TestRow{0, RandomString(12), false, rand.Intn(25), dbt.Time(time.Now())})
+	}
+	if n, err := db.Build().InsMany(TableName, many[:400]); err != nil || n != 400 {
+		t.Fatal("expected InsMany to insert 400 rows, got", n, err)
+	}
+	if n, err := db.Build().CopyMany(TableName, many[400:]); err != nil || n != 99 {
+		t.Fatal("expected CopyMany to insert 99 rows, got", n, err)
+	}
+	if _, err := db.Build().InsI(TableName, map[string]interface{}{"name": "mapped", "age": 30, "admin": false}).ExecE(); err != nil {
+		t.Fatal(err)
+	}
+	if db.QueryRowCount(TableName) != 501 {
+		t.Fatal("expected the map insert to add a row")
 	}
 	t.Log(db.QueryRowCount(TableName))
 
-	db.Build().Del(TableName).Wh("age", "12").Exe()
+	res, err := db.Build().Del(TableName).Wh("age", "12").ExecE()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Log(res.RowsAffected())
 	t.Log(db.QueryRowCount(TableName))
 
+	if _, err := db.Build().Se("*").Fr(TableName + "_missing").ExeE(); err == nil {
+		t.Fatal("expected an error selecting from a missing table")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := db.Build().Se("*").Fr(TableName).ExeContext(ctx); err == nil {
+		t.Fatal("expected an error querying with a canceled context")
+	}
+
+	errRollback := errors.New("rollback")
+	before := db.QueryRowCount(TableName)
+	err = db.WithTx(func(tx dbstorage.Tx) error {
+		id := tx.QueryNextID(TableName)
+		if _, err := tx.Build().InsI(TableName, &TestRow{id, RandomString(12), false, 12, dbt.Time(time.Now())}).ExecE(); err != nil {
+			return err
+		}
+		if tx.QueryRowCount(TableName) != before+1 {
+			t.Fatal("expected the insert to be visible inside the transaction")
+		}
+		return errRollback
+	})
+	if err != errRollback {
+		t.Fatal(err)
+	}
+	if db.QueryRowCount(TableName) != before {
+		t.Fatal("expected the transaction to be rolled back")
+	}
+	err = db.WithTx(func(tx dbstorage.Tx) error {
+		id := tx.QueryNextID(TableName)
+		_, err := tx.Build().InsI(TableName, &TestRow{id, RandomString(12), false, 12, dbt.Time(time.Now())}).ExecE()
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if db.QueryRowCount(TableName) != before+1 {
+		t.Fatal("expected the transaction to be committed")
+	}
+	err = db.WithTx(func(tx dbstorage.Tx) error {
+		err := tx.WithTx(func(inner dbstorage.Tx) error {
+			id := inner.QueryNextID(TableName)
+			if _, err := inner.Build().InsI(TableName, &TestRow{id, RandomString(12), false, 12, dbt.Time(time.Now())}).ExecE(); err != nil {
+				return err
+			}
+			return errRollback
+		})
+		if err != errRollback {
+			return err
+		}
+		return tx.WithTx(func(inner dbstorage.Tx) error {
+			id := inner.QueryNextID(TableName)
+			_, err := inner.Build().InsI(TableName, &TestRow{id, RandomString(12), false, 12, dbt.Time(time.Now())}).ExecE()
+			return err
+		})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if db.QueryRowCount(TableName) != before+2 {
+		t.Fatal("expected only the released savepoint to be committed")
+	}
+
+	hilo, err := dbstorage.NewHiLoAllocator(db, TableName+"_seq", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, gen := range []dbstorage.IDGenerator{dbstorage.NewTableAllocator(db), hilo} {
+		for i := 0; i < 15; i++ {
+			id, err := gen.NextID(context.Background(), TableName)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := db.Build().InsI(TableName, &TestRow{id, RandomString(12), false, 12, dbt.Time(time.Now())}).ExecE(); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	db.DropTable(TableName + "_seq")
+
+	// an insert that fails for another reason than losing the race is reported as is
+	if err := db.CreateTableE(TableName+"_seq", []string{"name", "varchar(191) primary key"}, [][]string{{"hi", "bigint check (hi < 0)"}}); err != nil {
+		t.Fatal(err)
+	}
+	hilo, err = dbstorage.NewHiLoAllocator(db, TableName+"_seq", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := hilo.NextID(context.Background(), TableName); err == nil || strings.Contains(err.Error(), "could not reserve") {
+		t.Fatal("expected the insert error from the hilo allocator, got", err)
+	}
+	db.DropTable(TableName + "_seq")
+
+	if _, err := db.Build().UpV(TableName, "admin", true).WhV("admin", false).WrV("age", "<", 3).ExecE(); err != nil {
+		t.Fatal(err)
+	}
+	rows, err = db.Build().Se("count(*)").Fr(TableName).WhV("admin", false).WrV("age", "<", 3).ExeE()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := 0
+	if rows.Next() {
+		rows.Scan(&c)
+	}
+	rows.Close()
+	if c != 0 {
+		t.Fatal("expected every row with an age under 3 to be an admin, found", c)
+	}
+
+	rows, err = db.Build().Se("id").Fr(TableName).WhereAny(dbstorage.C("age", "<", 3), dbstorage.AllOf(dbstorage.C("age", ">", 20), dbstorage.Not(dbstorage.Eq("admin", true)))).ExeE()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows.Close()
+
+	rows, err = db.Build().Se("id").Fr(TableName).Where(dbstorage.In("id", []int64{1, 2, 3}), dbstorage.NotIn("age", []int{}), dbstorage.Between("age", 0, 25), dbstorage.IsNotNull("name"), dbstorage.ILike("name", "%")).ExeE()
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := 0
+	for rows.Next() {
+		n++
+	}
+	rows.Close()
+	if n > 3 {
+		t.Fatal("expected at most 3 rows from an in of 3 ids, found", n)
+	}
+
+	rows, err = db.Build().Se("a.id, b.name").Fr(TableName+" a").Join(TableName+" b", dbstorage.On("b.id", "a.id")).LeftJoin(TableName+" c", dbstorage.On("c.id", "a.id"), dbstorage.Eq("c.admin", true)).Wh("a.id", "1").ExeE()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows.Close()
+
+	all := []TestRow{}
+	if err := dbstorage.ScanAllInto(db.Build().Se("*, 1 as extra").Fr(TableName).Or("id", "asc").Lm(10), &all); err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 10 || all[0].ID != 1 || all[0].Name != "returned" || !all[0].Admin {
+		t.Fatal("expected ScanAllInto to fill in the first 10 rows, got", all)
+	}
+	one := &TestRow{}
+	if err := dbstorage.ScanFirstInto(db.Build().Se("name, id").Fr(TableName).Or("id", "desc"), one); err != nil {
+		t.Fatal(err)
+	}
+	if one.ID < 500 || len(one.Name) == 0 {
+		t.Fatal("expected ScanFirstInto to fill in the last row, got", one)
+	}
+	if err := dbstorage.ScanFirstInto(db.Build().Se("*").Fr(TableName).WhV("id", -1), one); err != sql.ErrNoRows {
+		t.Fatal("expected sql.ErrNoRows, got", err)
+	}
+	if err := dbstorage.ScanAllInto(db.Build().Del(TableName).WhV("id", -1), &all); err == nil {
+		t.Fatal("expected an error scanning a delete without Returning")
+	}
+	if err := dbstorage.ScanFirstInto(db.Build().Del(TableName).WhV("id", -1), one); err == nil {
+		t.Fatal("expected an error scanning a delete without Returning")
+	}
+
+	got, err := dbstorage.Get[TestRow](db, TableName, 1)
+	if err != nil || got.Name != "returned" {
+		t.Fatal("expected Get to find the first row, got", got, err)
+	}
+	ptrs, err := dbstorage.All[*TestRow](db.Build().Se("*").Fr(TableName).Lm(3))
+	if err != nil || len(ptrs) != 3 || ptrs[2] == nil {
+		t.Fatal("expected All to scan 3 rows, got", ptrs, err)
+	}
+	ids, err := dbstorage.All[idRow](db.Build().Se("id").Fr(TableName).Or("id", "asc").Lm(3))
+	if err != nil || len(ids) != 3 || ids[0].ID != 1 {
+		t.Fatal("expected All to use Scannable, got", ids, err)
+	}
+	if _, err := dbstorage.First[TestRow](db.Build().Se("*").Fr(TableName).WhV("id", -1)); err != sql.ErrNoRows {
+		t.Fatal("expected sql.ErrNoRows, got", err)
+	}
+	if _, err := dbstorage.One[TestRow](db.Build().Se("*").Fr(TableName)); err != dbstorage.ErrTooManyRows {
+		t.Fatal("expected ErrTooManyRows, got", err)
+	}
+
+	seen := 0
+	for row, err := range dbstorage.Rows[TestRow](context.Background(), db.Build().Se("*").Fr(TableName).Or("id", "asc")) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		if seen++; seen == 5 {
+			if row.ID != all[4].ID {
+				t.Fatal("expected Rows to stream in order, got", row.ID)
+			}
+			break
+		}
+	}
+	if n := db.DB().Stats().InUse; n != 0 {
+		t.Fatal("expected breaking out of Rows to close the query, connections in use:", n)
+	}
+	for _, err := range dbstorage.Rows[TestRow](context.Background(), db.Build().Se("*").Fr(TableName+"_missing")) {
+		if err == nil {
+			t.Fatal("expected Rows to yield the query error")
+		}
+	}
+
+	if _, err := dbstorage.All[TestRow](db.Build().Del(TableName).WhV("id", -1)); err == nil {
+		t.Fatal("expected an error from All over a delete without Returning")
+	}
+	for _, err := range dbstorage.Rows[TestRow](context.Background(), db.Build().Up(TableName, "name", "x").WhV("id", -1)) {
+		if err == nil {
+			t.Fatal("expected Rows to yield an error over an update without Returning")
+		}
+	}
+
+	found, err := dbstorage.All[TestRow](db.FindByExample(TableName, TestRow{Name: "RETURN", Admin: true}, dbstorage.ExampleOptions{LikeStrings: true}))
+	if err != nil || len(found) != 1 || found[0].ID != 1 {
+		t.Fatal("expected FindByExample to find the first row, got", found, err)
+	}
+	if n, err := db.FindByExample(TableName, TestRow{Name: "RETURN"}, dbstorage.ExampleOptions{}).Count(); err != nil || n != 0 {
+		t.Fatal("expected FindByExample to match strings exactly by default, got", n, err)
+	}
+	if n, err := db.FindByExample(TableName, TestRow{ID: 1, Birthday: dbt.Time(time.Now())}, dbstorage.ExampleOptions{TimeWindow: time.Hour}).Count(); err != nil || n != 1 {
+		t.Fatal("expected FindByExample to match the birthday within an hour, got", n, err)
+	}
+
+	pages := 0
+	seenIDs := map[int64]bool{}
+	var last, beforeLast dbstorage.Page[TestRow]
+	for cur := ""; pages == 0 || len(cur) > 0; cur = last.Next {
+		beforeLast = last
+		last, err = dbstorage.Paginate[TestRow](db.Build().Se("*").Fr(TableName), []string{"age desc", "id"}, cur, 50)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, item := range last.Items {
+			if seenIDs[item.ID] {
+				t.Fatal("expected each row on one page only, saw again", item.ID)
+			}
+			seenIDs[item.ID] = true
+		}
+		pages++
+	}
+	if int64(len(seenIDs)) != db.QueryRowCount(TableName) || pages < 2 || len(last.Prev) == 0 {
+		t.Fatal("expected to page through every row, got", len(seenIDs), pages)
+	}
+	prev, err := dbstorage.Paginate[TestRow](db.Build().Se("*").Fr(TableName), []string{"age desc", "id"}, last.Prev, 50)
+	if err != nil || len(prev.Items) != 50 || prev.Items[0].ID != beforeLast.Items[0].ID || prev.Items[49].ID != beforeLast.Items[49].ID {
+		t.Fatal("expected Prev of the last page to be the page before it", err)
+	}
+	// an order already on the builder leads the sort key, and the builder can be reused for every page
+	ordered := db.Build().Se("*").Fr(TableName).Or("age", "desc")
+	seenIDs = map[int64]bool{}
+	next := dbstorage.Page[TestRow]{}
+	for cur := ""; len(seenIDs) == 0 || len(cur) > 0; cur = next.Next {
+		next, err = dbstorage.Paginate[TestRow](ordered, []string{"id"}, cur, 50)
+		if err != nil || len(next.Items) == 0 {
+			t.Fatal("expected a page after a prior order, got", len(next.Items), err)
+		}
+		for _, item := range next.Items {
+			if seenIDs[item.ID] {
+				t.Fatal("expected each row on one page only with a prior order, saw again", item.ID)
+			}
+			seenIDs[item.ID] = true
+		}
+	}
+	if int64(len(seenIDs)) != db.QueryRowCount(TableName) || next.Items[0].ID != last.Items[0].ID {
+		t.Fatal("expected a prior order to page the same as passing it to Paginate, got", len(seenIDs))
+	}
+	lowest, err := dbstorage.First[TestRow](db.Build().Se("*").Fr(TableName).Or("id", "asc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if offset, err := dbstorage.Paginate[TestRow](db.Build().Se("*").Fr(TableName).Of(3), []string{"id"}, "", 3); err != nil || len(offset.Items) != 3 || offset.Items[0].ID != lowest.ID {
+		t.Fatal("expected Paginate to ignore the offset of the builder", err)
+	}
+	if _, err := dbstorage.Paginate[TestRow](db.Build().Se("*").Fr(TableName), []string{"id"}, "not a cursor", 50); err == nil {
+		t.Fatal("expected an error for an invalid cursor")
+	}
+
+	total, err := db.Build().Se("*").Fr(TableName).Or("id", "desc").Lm(5).Count()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != db.QueryRowCount(TableName) {
+		t.Fatal("Count and QueryRowCount disagree", total)
+	}
+	sum, err := db.Build().Fr(TableName).Sum("age")
+	if err != nil {
+		t.Fatal(err)
+	}
+	avg, err := db.Build().Fr(TableName).Avg("age")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total > 0 && (avg < float64(sum)/float64(total)-0.01 || avg > float64(sum)/float64(total)+0.01) {
+		t.Fatal("expected the average to be the sum over the count", sum, avg, total)
+	}
+	var youngest, oldest int
+	if err := db.Build().Fr(TableName).Min("age", &youngest); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Build().Fr(TableName).Max("age", &oldest); err != nil {
+		t.Fatal(err)
+	}
+	if youngest > oldest {
+		t.Fatal("expected min to be at most max", youngest, oldest)
+	}
+	rows, err = db.Build().Se("age, count(*)").Fr(TableName).GroupBy("age").Having(dbstorage.C("count(*)", ">", 0)).Or("age", "asc").ExeE()
+	if err != nil {
+		t.Fatal(err)
+	}
+	groups := int64(0)
+	for rows.Next() {
+		var age, c int64
+		if err := rows.Scan(&age, &c); err != nil {
+			t.Fatal(err)
+		}
+		groups += c
+	}
+	rows.Close()
+	if groups != total {
+		t.Fatal("expected the groups to add up to the count", groups, total)
+	}
+
 	db.Build().Up(TableName, "admin", "1").Wh("admin", "0").Wh("age", "12").Exe()
 
 	db.Build().Se("*").Fr(TableName).Wh("age", "14").Lm(25).Exe().Close()
@@ -63,12 +510,87 @@ func DoTest(t *testing.T, db dbstorage.Database) {
 
 	db.Build().Se("*").Fr(TableName).Wh("name", "meghan").Exe().Close()
 
+	repo, err := dbstorage.NewRepository[TestRow](db, TableName+"_repo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	row := &TestRow{Name: "created", Age: 7}
+	if err := repo.Create(row); err != nil || row.ID != 1 {
+		t.Fatal("expected Create to assign id 1, got", row.ID, err)
+	}
+	if err := repo.Create(&TestRow{Name: "second", Age: 8}); err != nil {
+		t.Fatal(err)
+	}
+	row.Name = "updated"
+	if err := repo.Update(row, "name"); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := repo.Get(row.ID); err != nil || got.Name != "updated" || got.Age != 7 {
+		t.Fatal("expected Get to see the update, got", got, err)
+	}
+	if list, err := repo.List(dbstorage.C("age", ">", 7)); err != nil || len(list) != 1 || list[0].Name != "second" {
+		t.Fatal("expected List to filter by age, got", list, err)
+	}
+	if err := repo.Delete(row.ID); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := repo.Exists(row.ID); err != nil || ok {
+		t.Fatal("expected the deleted row to be gone", err)
+	}
+	if n, err := repo.Count(); err != nil || n != 1 {
+		t.Fatal("expected one row left, got", n, err)
+	}
+	db.DropTable(repo.Table())
+
+	type Tag struct {
+		ID   string `json:"id"`
+		Name string `json:"name" dbsorm:"1"`
+	}
+	tags, err := dbstorage.NewRepository[Tag](db, TableName+"_tags")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tag := &Tag{Name: "go"}
+	if err := tags.Create(tag); err != nil || len(tag.ID) != 36 {
+		t.Fatal("expected Create to assign a UUID, got", tag.ID, err)
+	}
+	if got, err := tags.Get(tag.ID); err != nil || got != *tag {
+		t.Fatal("expected Get to find the tag, got", got, err)
+	}
+	db.DropTable(tags.Table())
+
 	db.DropTable(TableName)
 	t.Log(db.QueryRowCount(TableName))
 
 	db.Close()
 }
 
+func TestSnowflake(t *testing.T) {
+	gen, err := dbstorage.NewSnowflake(7)
+	util.DieOnError(err)
+	last := int64(0)
+	for i := 0; i < 10000; i++ {
+		id, _ := gen.NextID(context.Background(), TableName)
+		if id <= last {
+			t.Fatal("snowflake ids must increase", last, id)
+		}
+		last = id
+	}
+}
+
+func TestUUIDv7(t *testing.T) {
+	gen := dbstorage.NewUUIDv7()
+	a, _ := gen.NextStringID(context.Background(), TableName)
+	time.Sleep(2 * time.Millisecond)
+	b, _ := gen.NextStringID(context.Background(), TableName)
+	if len(a) != 36 || a[14] != '7' || !strings.ContainsRune("89ab", rune(a[19])) {
+		t.Fatal("not a version 7 uuid:", a)
+	}
+	if a >= b {
+		t.Fatal("uuidv7 ids must sort by time", a, b)
+	}
+}
+
 //
 //
 //
@@ -0,0 +1,840 @@
+package dbstorage
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"reflect"
+	"runtime/debug"
+	"strconv"
+	"strings"
+
+	"github.com/nektro/go-util/arrays/stringsu"
+	"github.com/nektro/go-util/util"
+
+	. "github.com/nektro/go-util/alias"
+)
+
+const (
+	kindSelect = iota
+	kindUpdate
+	kindInsert
+	kindDelete
+)
+
+type join struct {
+	kind  string
+	table string
+	on    []Cond
+}
+
+type assignment struct {
+	col   string
+	value interface{}
+}
+
+type queryBuilder struct {
+	d   *DbProxy        // db
+	k   int             // kind
+	m   bool            // modify
+	c   string          // select columns
+	t   string          // table
+	j   []join          // join's
+	s   []assignment    // set's
+	ic  []string        // insert columns, nil for positional values
+	iv  []interface{}   // insert values
+	im  [][]interface{} // more rows of insert values
+	u   bool            // upsert
+	uc  []string        // upsert conflict columns
+	uu  []string        // upsert update columns, none to ignore conflicts
+	w   []Cond          // where's, joined with and
+	g   []string        // group by's
+	h   []Cond          // having's, joined with and
+	o   [][2]string     // order's
+	l   int64           // limit
+	f   int64           // offset
+	ret []string        // returning columns
+	lk  bool            // lock the selected rows with for update
+	err error           // from building, reported when the query is rendered
+}
+
+func (db *DbProxy) Build() QueryBuilder {
+	qb := new(queryBuilder)
+	qb.d = db
+	return qb
+}
+
+func (qb *queryBuilder) Se(cols string) QueryBuilder {
+	qb.k = kindSelect
+	qb.m = false
+	qb.c = cols
+	return qb
+}
+
+func (qb *queryBuilder) Fr(table string) QueryBuilder {
+	qb.t = table
+	return qb
+}
+
+// Join adds an inner join of table, matching rows where all of on do.
+func (qb *queryBuilder) Join(table string, on ...Cond) QueryBuilder {
+	qb.j = append(qb.j, join{"join", table, on})
+	return qb
+}
+
+// LeftJoin adds a left join of table, matching rows where all of on do.
+func (qb *queryBuilder) LeftJoin(table string, on ...Cond) QueryBuilder {
+	qb.j = append(qb.j, join{"left join", table, on})
+	return qb
+}
+
+// RightJoin adds a right join of table, matching rows where all of on do. SQLite supports it from 3.39.0.
+func (qb *queryBuilder) RightJoin(table string, on ...Cond) QueryBuilder {
+	qb.j = append(qb.j, join{"right join", table, on})
+	return qb
+}
+
+// CrossJoin adds every combination with the rows of table.
+func (qb *queryBuilder) CrossJoin(table string) QueryBuilder {
+	qb.j = append(qb.j, join{"cross join", table, nil})
+	return qb
+}
+
+func (qb *queryBuilder) WR(col string, op string, value string, raw bool, ags ...interface{}) QueryBuilder {
+	if raw {
+		qb.w = append(qb.w, &rawCond{col, op, value, ags})
+	} else {
+		qb.w = append(qb.w, C(col, op, value))
+	}
+	return qb
+}
+
+func (qb *queryBuilder) Wr(col string, op string, value string) QueryBuilder {
+	qb.WR(col, op, value, false)
+	return qb
+}
+
+func (qb *queryBuilder) Wh(col string, value string) QueryBuilder {
+	qb.Wr(col, "=", value)
+	return qb
+}
+
+func (qb *queryBuilder) WrV(col string, op string, value interface{}) QueryBuilder {
+	qb.w = append(qb.w, C(col, op, value))
+	return qb
+}
+
+func (qb *queryBuilder) WhV(col string, value interface{}) QueryBuilder {
+	qb.WrV(col, "=", value)
+	return qb
+}
+
+// Where adds each of conds to the where clause.
+func (qb *queryBuilder) Where(conds ...Cond) QueryBuilder {
+	qb.w = append(qb.w, conds...)
+	return qb
+}
+
+// WhereAny adds a group to the where clause that matches when any of conds do.
+func (qb *queryBuilder) WhereAny(conds ...Cond) QueryBuilder {
+	qb.w = append(qb.w, AnyOf(conds...))
+	return qb
+}
+
+// WhereAll adds a group to the where clause that matches when all of conds do.
+func (qb *queryBuilder) WhereAll(conds ...Cond) QueryBuilder {
+	qb.w = append(qb.w, AllOf(conds...))
+	return qb
+}
+
+func (qb *queryBuilder) GroupBy(cols ...string) QueryBuilder {
+	qb.g = append(qb.g, cols...)
+	return qb
+}
+
+// Having adds each of conds to the having clause, their columns may be aggregates such as count(*).
+func (qb *queryBuilder) Having(conds ...Cond) QueryBuilder {
+	qb.h = append(qb.h, conds...)
+	return qb
+}
+
+func (qb *queryBuilder) Or(col string, order string) QueryBuilder {
+	qb.o = append(qb.o, [2]string{col, order})
+	return qb
+}
+
+func (qb *queryBuilder) Lm(limit int64) QueryBuilder {
+	qb.l = limit
+	return qb
+}
+
+func (qb *queryBuilder) Of(offset int64) QueryBuilder {
+	qb.f = offset
+	return qb
+}
+
+// query renders the final statement and its bound values without modifying the builder.
+func (qb *queryBuilder) query() (string, []interface{}, error) {
+	if qb.err != nil {
+		return "", nil, qb.err
+	}
+	r := &renderer{d: qb.d.dialect}
+	switch qb.k {
+	case kindSelect:
+		r.raw("select ")
+		r.selectList(qb.c)
+		r.raw(" from ")
+		r.table(qb.t)
+		for _, item := range qb.j {
+			r.raw(" " + item.kind + " ")
+			r.table(item.table)
+			if len(item.on) > 0 {
+				r.raw(" on ")
+				r.join(item.on, " and ")
+			}
+		}
+	case kindUpdate:
+		r.raw("update ")
+		r.table(qb.t)
+		r.raw(" set ")
+		for i, item := range qb.s {
+			if i > 0 {
+				r.raw(", ")
+			}
+			r.name(item.col)
+			r.raw(" = ")
+			r.bind(item.value)
+		}
+	case kindInsert:
+		insert, suffix := "insert into", ""
+		if qb.u {
+			insert, suffix = r.d.Upsert(r.quotedNames(qb.uc), r.quotedNames(qb.uu))
+		}
+		r.raw(insert + " ")
+		r.table(qb.t)
+		if qb.ic != nil {
+			r.raw(" (")
+			r.names(qb.ic)
+			r.raw(")")
+		}
+		r.raw(" values ")
+		for i, row := range append([][]interface{}{qb.iv}, qb.im...) {
+			if i > 0 {
+				r.raw(",")
+			}
+			r.raw("(")
+			for j, item := range row {
+				if j > 0 {
+					r.raw(",")
+				}
+				r.bind(item)
+			}
+			r.raw(")")
+		}
+		r.raw(suffix)
+	case kindDelete:
+		r.raw("delete from ")
+		r.table(qb.t)
+	}
+	if len(qb.w) > 0 {
+		r.raw(" where ")
+		r.join(qb.w, " and ")
+	}
+	for i, item := range qb.g {
+		if i == 0 {
+			r.raw(" group by ")
+		} else {
+			r.raw(", ")
+		}
+		r.expr(item)
+	}
+	if len(qb.h) > 0 {
+		r.raw(" having ")
+		r.join(qb.h, " and ")
+	}
+	for i, item := range qb.o {
+		if i == 0 {
+			r.raw(" order by ")
+		} else {
+			r.raw(", ")
+		}
+		r.expr(item[0])
+		r.order(item[1])
+	}
+	if qb.l > 0 {
+		r.raw(" limit " + strconv.FormatInt(qb.l, 10))
+
+		if qb.f > 0 {
+			r.raw(" offset " + strconv.FormatInt(qb.f, 10))
+		}
+	}
+	if qb.lk {
+		r.raw(" for update")
+	}
+	if len(qb.ret) > 0 {
+		r.raw(" returning ")
+		r.names(qb.ret)
+	}
+	if r.err != nil {
+		return "", nil, r.err
+	}
+	q := r.buf.String()
+	if StatementDebug {
+		st := bytes.Split(debug.Stack(), []byte("\n"))
+		for _, item := range st {
+			if len(item) == 0 || item[0] != '\t' {
+				continue
+			}
+			if bytes.Contains(item, []byte("src/runtime/debug")) || bytes.Contains(item, []byte("github.com/nektro/go.dbstorage")) {
+				continue
+			}
+			fmt.Println("---", string(item[1:]), "\t", "-", q)
+			break
+		}
+	}
+	return q, r.args, nil
+}
+
+func (qb *queryBuilder) Exe() *sql.Rows {
+	rows, _ := qb.ExeE()
+	return rows
+}
+
+func (qb *queryBuilder) ExeE() (*sql.Rows, error) {
+	return qb.ExeContext(context.Background())
+}
+
+func (qb *queryBuilder) ExeContext(ctx context.Context) (*sql.Rows, error) {
+	if qb.m && len(qb.ret) > 0 && !qb.d.dialect.Returning() {
+		return qb.emulateReturning(ctx)
+	}
+	q, args, err := qb.query()
+	if err != nil {
+		return nil, err
+	}
+	return qb.d.QueryPreparedContext(ctx, qb.m && len(qb.ret) == 0, q, args...)
+}
+
+// Returning makes Exe return cols of each row inserted or updated, or deleted when the backend supports it.
+// Where it is emulated the query must be built from a Tx.
+func (qb *queryBuilder) Returning(cols ...string) QueryBuilder {
+	qb.ret = append(qb.ret, cols...)
+	return qb
+}
+
+// emulateReturning runs an insert or update and then selects the rows it changed by id, for backends without
+// returning. The rows are read after the statement, so qb must be built from a Tx for them to still be the ones
+// it changed, and they stay in that transaction until it ends.
+func (qb *queryBuilder) emulateReturning(ctx context.Context) (*sql.Rows, error) {
+	if qb.k == kindDelete {
+		return nil, E("dbstorage: returning from a delete is not supported by " + qb.d.dialect.DriverName())
+	}
+	if qb.d.tx == nil {
+		return nil, E("dbstorage: returning is emulated on " + qb.d.dialect.DriverName() + " and needs a transaction, build the query from a Tx")
+	}
+	c := *qb
+	c.ret = nil
+	ids := []interface{}{}
+	if c.k == kindUpdate {
+		s := &queryBuilder{d: c.d, k: kindSelect, c: "id", t: c.t, j: c.j, w: c.w, o: c.o, l: c.l, f: c.f, lk: true}
+		rows, err := s.ExeContext(ctx)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var id interface{}
+			if err := rows.Scan(&id); err != nil {
+				return nil, err
+			}
+			ids = append(ids, id)
+		}
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+		rows.Close()
+		if _, err := c.ExecContext(ctx); err != nil {
+			return nil, err
+		}
+	} else {
+		res, err := c.ExecContext(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if i := indexOf(c.ic, "id"); i >= 0 {
+			for _, item := range append([][]interface{}{c.iv}, c.im...) {
+				ids = append(ids, item[i])
+			}
+		} else {
+			first, err := res.LastInsertId()
+			if err != nil {
+				return nil, err
+			}
+			for i := 0; i <= len(c.im); i++ {
+				ids = append(ids, first+int64(i))
+			}
+		}
+	}
+	return qb.d.Build().Se(strings.Join(qb.ret, ", ")).Fr(qb.t).Where(In("id", ids)).Or("id", "asc").ExeContext(ctx)
+}
+
+func (qb *queryBuilder) ExecE() (sql.Result, error) {
+	return qb.ExecContext(context.Background())
+}
+
+func (qb *queryBuilder) ExecContext(ctx context.Context) (sql.Result, error) {
+	q, args, err := qb.query()
+	if err != nil {
+		return nil, err
+	}
+	return qb.d.ExecPreparedContext(ctx, q, args...)
+}
+
+func (qb *queryBuilder) Count() (int64, error) {
+	return qb.CountContext(context.Background())
+}
+
+// CountContext is the number of rows matched, or of the first group if there is a group by.
+func (qb *queryBuilder) CountContext(ctx context.Context) (int64, error) {
+	result := int64(0)
+	err := qb.aggregate(ctx, "count(*)", &result)
+	return result, err
+}
+
+func (qb *queryBuilder) Sum(col string) (float64, error) {
+	return qb.SumContext(context.Background(), col)
+}
+
+// SumContext is the sum of col over the rows matched, 0 if there are none.
+func (qb *queryBuilder) SumContext(ctx context.Context, col string) (float64, error) {
+	result := sql.NullFloat64{}
+	err := qb.aggregate(ctx, "sum("+col+")", &result)
+	return result.Float64, err
+}
+
+func (qb *queryBuilder) Avg(col string) (float64, error) {
+	return qb.AvgContext(context.Background(), col)
+}
+
+// AvgContext is the average of col over the rows matched, 0 if there are none.
+func (qb *queryBuilder) AvgContext(ctx context.Context, col string) (float64, error) {
+	result := sql.NullFloat64{}
+	err := qb.aggregate(ctx, "avg("+col+")", &result)
+	return result.Float64, err
+}
+
+func (qb *queryBuilder) Min(col string, dest interface{}) error {
+	return qb.MinContext(context.Background(), col, dest)
+}
+
+// MinContext scans the smallest col of the rows matched into dest. It is null when there are none,
+// so dest should be a sql.Null type if that can happen.
+func (qb *queryBuilder) MinContext(ctx context.Context, col string, dest interface{}) error {
+	return qb.aggregate(ctx, "min("+col+")", dest)
+}
+
+func (qb *queryBuilder) Max(col string, dest interface{}) error {
+	return qb.MaxContext(context.Background(), col, dest)
+}
+
+// MaxContext scans the largest col of the rows matched into dest. It is null when there are none,
+// so dest should be a sql.Null type if that can happen.
+func (qb *queryBuilder) MaxContext(ctx context.Context, col string, dest interface{}) error {
+	return qb.aggregate(ctx, "max("+col+")", dest)
+}
+
+// aggregate selects expr from the table, joins, and conditions of qb and scans the first row into dest.
+// Order, limit, and offset are left out since they do not apply to a single aggregate row.
+func (qb *queryBuilder) aggregate(ctx context.Context, expr string, dest interface{}) error {
+	a := *qb
+	a.k = kindSelect
+	a.m = false
+	a.c = expr
+	a.o = nil
+	a.l = 0
+	a.f = 0
+	rows, err := a.ExeContext(ctx)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	if rows.Next() {
+		if err := rows.Scan(dest); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func (qb *queryBuilder) Up(table string, col string, value string) QueryBuilder {
+	qb.UpV(table, col, value)
+	return qb
+}
+
+func (qb *queryBuilder) UpV(table string, col string, value interface{}) QueryBuilder {
+	qb.k = kindUpdate
+	qb.m = true
+	qb.t = table
+	qb.s = append(qb.s, assignment{col, value})
+	return qb
+}
+
+// Set adds another column to the update started by Up, UpV, or UpI.
+func (qb *queryBuilder) Set(col string, value interface{}) QueryBuilder {
+	qb.s = append(qb.s, assignment{col, value})
+	return qb
+}
+
+// UpI updates the row of table with the id of strct to the values of its json tagged fields,
+// or only those named in cols if there are any.
+func (qb *queryBuilder) UpI(table string, strct interface{}, cols ...string) QueryBuilder {
+	return qb.upI(table, strct, cols, false)
+}
+
+// UpINZ is UpI for only the fields of strct that are not their zero value.
+func (qb *queryBuilder) UpINZ(table string, strct interface{}) QueryBuilder {
+	return qb.upI(table, strct, nil, true)
+}
+
+func (qb *queryBuilder) upI(table string, strct interface{}, only []string, nonZero bool) QueryBuilder {
+	qb.k = kindUpdate
+	qb.m = true
+	qb.t = table
+	cols, vals, id, err := updateColumns(strct, only, nonZero)
+	if err != nil {
+		qb.err = err
+		return qb
+	}
+	if len(cols) == 0 {
+		qb.err = E(F("dbstorage: no columns of %T to update", strct))
+		return qb
+	}
+	for i, item := range cols {
+		qb.s = append(qb.s, assignment{item, vals[i]})
+	}
+	qb.w = append(qb.w, Eq("id", id))
+	return qb
+}
+
+func (qb *queryBuilder) Ins(table string, values ...interface{}) Executable {
+	qb.k = kindInsert
+	qb.m = true
+	qb.t = table
+	qb.iv = append(qb.iv, values...)
+	return qb
+}
+
+// InsI inserts the json tagged fields of strct by column name, so their order does not need to match the table.
+// A zero id is left out so it is generated. strct may also be a map[string]interface{} from column names to values.
+func (qb *queryBuilder) InsI(table string, strct interface{}) Executable {
+	qb.k = kindInsert
+	qb.m = true
+	qb.t = table
+	qb.ic, qb.iv = insertColumns(strct, zeroID(strct))
+	return qb
+}
+
+func (qb *queryBuilder) InsID(table string, strct interface{}) (int64, error) {
+	return qb.InsIDContext(context.Background(), table, strct)
+}
+
+func (qb *queryBuilder) InsIDContext(ctx context.Context, table string, strct interface{}) (int64, error) {
+	qb.k = kindInsert
+	qb.m = true
+	qb.t = table
+	qb.ic, qb.iv = insertColumns(strct, "id")
+	if !qb.d.dialect.LastInsertID() {
+		qb.ret = []string{"id"}
+	}
+	q, args, err := qb.query()
+	if err != nil {
+		return 0, err
+	}
+	id := int64(0)
+	if qb.d.dialect.LastInsertID() {
+		res, err := qb.d.ExecPreparedContext(ctx, q, args...)
+		if err != nil {
+			return 0, err
+		}
+		id, err = res.LastInsertId()
+		if err != nil {
+			return 0, err
+		}
+	} else {
+		rows, err := qb.d.QueryPreparedContext(ctx, false, q, args...)
+		if err != nil {
+			return 0, err
+		}
+		defer rows.Close()
+		if rows.Next() {
+			if err := rows.Scan(&id); err != nil {
+				return 0, err
+			}
+		}
+		if err := rows.Err(); err != nil {
+			return 0, err
+		}
+	}
+	setStructID(strct, id)
+	return id, nil
+}
+
+func (qb *queryBuilder) InsMany(table string, rows interface{}) (int64, error) {
+	return qb.InsManyContext(context.Background(), table, rows)
+}
+
+// InsManyContext inserts each struct or map in the slice rows with as few statements as the backend's
+// MaxParams allows, all in one transaction. Zero ids are left out so they are generated. It returns the
+// number of rows inserted.
+func (qb *queryBuilder) InsManyContext(ctx context.Context, table string, rows interface{}) (int64, error) {
+	cols, vals, err := manyColumns(rows)
+	if err != nil || len(vals) == 0 {
+		return 0, err
+	}
+	size := qb.d.dialect.MaxParams() / len(cols)
+	if size == 0 {
+		return 0, E(F("dbstorage: %d columns is more than the %d values %s can bind at once", len(cols), qb.d.dialect.MaxParams(), qb.d.dialect.DriverName()))
+	}
+	total := int64(0)
+	err = qb.d.inTx(ctx, func(db *DbProxy) error {
+		for start := 0; start < len(vals); start += size {
+			end := start + size
+			if end > len(vals) {
+				end = len(vals)
+			}
+			c := &queryBuilder{d: db, k: kindInsert, m: true, t: table, ic: cols, iv: vals[start], im: vals[start+1 : end]}
+			res, err := c.ExecContext(ctx)
+			if err != nil {
+				return err
+			}
+			n, err := res.RowsAffected()
+			if err != nil {
+				return err
+			}
+			total += n
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return total, nil
+}
+
+func (qb *queryBuilder) CopyMany(table string, rows interface{}) (int64, error) {
+	return qb.CopyManyContext(context.Background(), table, rows)
+}
+
+// CopyManyContext is InsManyContext using the backend's bulk loading when it has one, such as COPY on PostgreSQL.
+func (qb *queryBuilder) CopyManyContext(ctx context.Context, table string, rows interface{}) (int64, error) {
+	c, ok := qb.d.dialect.(copier)
+	if !ok {
+		return qb.InsManyContext(ctx, table, rows)
+	}
+	cols, vals, err := manyColumns(rows)
+	if err != nil || len(vals) == 0 {
+		return 0, err
+	}
+	err = qb.d.inTx(ctx, func(db *DbProxy) error {
+		return c.CopyIn(ctx, db.tx, table, cols, vals)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return int64(len(vals)), nil
+}
+
+// Upsert inserts strct into table, or when that conflicts on conflictCols updates the existing row's
+// updateCols instead. With no updateCols, every inserted column not in conflictCols is updated.
+// MySQL uses whichever unique key conflicted rather than conflictCols.
+func (qb *queryBuilder) Upsert(table string, strct interface{}, conflictCols []string, updateCols []string) Executable {
+	qb.upsert(table, strct)
+	qb.uc = conflictCols
+	qb.uu = updateCols
+	if len(qb.uu) == 0 {
+		for _, item := range qb.ic {
+			if !stringsu.Contains(conflictCols, item) {
+				qb.uu = append(qb.uu, item)
+			}
+		}
+	}
+	if len(qb.uc) == 0 || len(qb.uu) == 0 {
+		qb.err = E("dbstorage: upsert needs conflict columns and at least one column to update")
+	}
+	return qb
+}
+
+// InsIgnore inserts strct into table unless it conflicts with an existing row, then it does nothing.
+func (qb *queryBuilder) InsIgnore(table string, strct interface{}) Executable {
+	qb.upsert(table, strct)
+	return qb
+}
+
+// upsert sets up an insert of the json tagged fields of strct, leaving out a zero id so it is generated.
+func (qb *queryBuilder) upsert(table string, strct interface{}) {
+	qb.k = kindInsert
+	qb.m = true
+	qb.t = table
+	qb.u = true
+	qb.ic, qb.iv = insertColumns(strct, zeroID(strct))
+}
+
+// zeroID is "id" when the id field of the struct strct is zero, to be left out of an insert, otherwise "".
+func zeroID(strct interface{}) string {
+	v := reflect.Indirect(reflect.ValueOf(strct))
+	if sf, ok := structField(v.Type(), "id"); ok && v.FieldByIndex(sf.Index).IsZero() {
+		return "id"
+	}
+	return ""
+}
+
+func (qb *queryBuilder) Del(table string) QueryBuilder {
+	qb.k = kindDelete
+	qb.m = true
+	qb.t = table
+	return qb
+}
+
+// indexOf is the index of needle in stack, or -1.
+func indexOf(stack []string, needle string) int {
+	for i, item := range stack {
+		if item == needle {
+			return i
+		}
+	}
+	return -1
+}
+
+//
+//
+
+// renderer writes a statement while collecting its bound values, so each placeholder
+// is numbered as it is written rather than by searching the finished text for '?'.
+type renderer struct {
+	d    Dialect
+	buf  strings.Builder
+	args []interface{}
+	err  error // first invalid identifier, operator, or value
+}
+
+func (r *renderer) raw(s string) {
+	r.buf.WriteString(s)
+}
+
+// quoted writes the result of one of the quote functions, keeping the first error.
+func (r *renderer) quoted(s string, err error) {
+	if err != nil && r.err == nil {
+		r.err = err
+	}
+	r.raw(s)
+}
+
+func (r *renderer) name(s string) {
+	r.quoted(quoteName(r.d, s))
+}
+
+func (r *renderer) names(s []string) {
+	for i, item := range s {
+		if i > 0 {
+			r.raw(", ")
+		}
+		r.name(item)
+	}
+}
+
+// quotedNames returns each of s quoted, for the Dialect methods that take quoted names.
+func (r *renderer) quotedNames(s []string) []string {
+	result := []string{}
+	for _, item := range s {
+		q, err := quoteName(r.d, item)
+		r.quoted("", err)
+		result = append(result, q)
+	}
+	return result
+}
+
+func (r *renderer) expr(s string) {
+	r.quoted(quoteExpr(r.d, s))
+}
+
+func (r *renderer) table(s string) {
+	r.quoted(quoteTable(r.d, s))
+}
+
+func (r *renderer) selectList(s string) {
+	r.quoted(quoteSelect(r.d, s))
+}
+
+func (r *renderer) op(s string) {
+	r.quoted(" "+strings.TrimSpace(s)+" ", checkOperator(r.d, strings.TrimSpace(s)))
+}
+
+func (r *renderer) order(s string) {
+	o, err := orderDirection(s)
+	r.quoted(" "+o, err)
+}
+
+// join writes each of conds separated by sep.
+func (r *renderer) join(conds []Cond, sep string) {
+	for i, item := range conds {
+		if i > 0 {
+			r.raw(sep)
+		}
+		item.render(r)
+	}
+}
+
+// bind writes a placeholder for v.
+func (r *renderer) bind(v interface{}) {
+	r.raw(r.placeholder(v))
+}
+
+// placeholder adds v to the bound values and returns its placeholder.
+func (r *renderer) placeholder(v interface{}) string {
+	o, err := bindValue(v)
+	if err != nil && r.err == nil {
+		r.err = err
+	}
+	r.args = append(r.args, o)
+	return r.d.Placeholder(len(r.args))
+}
+
+// bindValue converts v the same way database/sql would so it reaches the driver as a native value.
+// Bools are sent as 1 and 0 to match the integer columns TypeForType makes for them.
+func bindValue(v interface{}) (driver.Value, error) {
+	o, err := driver.DefaultParameterConverter.ConvertValue(v)
+	if b, ok := o.(bool); ok {
+		o = int64(util.Btoi(b))
+	}
+	return o, err
+}
+
+// fragment writes caller-provided SQL. Each ? outside of quotes is bound to the next arg in order, ?? is
+// written as a literal ?, and a ? with no arg left is written as is.
+func (r *renderer) fragment(s string, args []interface{}) {
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0 && c == '\\' && r.d.BackslashEscapes() && i+1 < len(s):
+			r.buf.WriteByte(c)
+			i++
+			c = s[i]
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"' || c == '`':
+			quote = c
+		case c == '?' && i+1 < len(s) && s[i+1] == '?':
+			i++
+		case c == '?' && len(args) > 0:
+			r.bind(args[0])
+			args = args[1:]
+			continue
+		}
+		r.buf.WriteByte(c)
+	}
+}
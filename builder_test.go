@@ -0,0 +1,441 @@
+package dbstorage
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+type testRow struct {
+	ID    int64  `json:"id"`
+	Name  string `json:"name"`
+	Admin bool   `json:"admin"`
+	Age   int    `json:"age"`
+}
+
+func TestPlaceholders(t *testing.T) {
+	pg := &DbProxy{dialect: postgresDialect{}}
+	lite := &DbProxy{dialect: sqliteDialect{}}
+	my := &DbProxy{dialect: mysqlDialect{}}
+
+	cases := []struct {
+		name string
+		qb   QueryBuilder
+		q    string
+		args []interface{}
+	}{
+		{
+			"question mark in a bound value",
+			pg.Build().Se("*").Fr("t").Wh("a", "what?"),
+			`select * from "t" where "a" = $1`,
+			[]interface{}{"what?"},
+		},
+		{
+			"jsonb operator in a raw value without args",
+			pg.Build().Se("*").Fr("t").WR("data", "?", "'key'", true),
+			`select * from "t" where "data" ? 'key'`,
+			nil,
+		},
+		{
+			"question mark in a string literal of a raw value",
+			pg.Build().Se("*").Fr("t").WR("a", "=", "coalesce(?, 'x?')", true, 5),
+			`select * from "t" where "a" = coalesce($1, 'x?')`,
+			[]interface{}{int64(5)},
+		},
+		{
+			"escaped question mark in a raw value with args",
+			pg.Build().Se("*").Fr("t").WR("data", "@>", "?::jsonb and data ?? 'k'", true, `{"a":"?"}`),
+			`select * from "t" where "data" @> $1::jsonb and data ? 'k'`,
+			[]interface{}{`{"a":"?"}`},
+		},
+		{
+			"escaped question mark in a raw value without args",
+			pg.Build().Se("*").Fr("t").WR("data", "@>", "'{}'::jsonb and data ?? 'k'", true),
+			`select * from "t" where "data" @> '{}'::jsonb and data ? 'k'`,
+			nil,
+		},
+		{
+			"backslash escaped quote on mysql",
+			my.Build().Se("*").Fr("t").WR("a", "=", `concat('it\'s ?', ?)`, true, "x"),
+			"select * from `t` where `a` = concat('it\\'s ?', ?)",
+			[]interface{}{"x"},
+		},
+		{
+			"backslash is not an escape on postgres",
+			pg.Build().Se("*").Fr("t").WR("a", "=", `'c:\' || ?`, true, "x"),
+			`select * from "t" where "a" = 'c:\' || $1`,
+			[]interface{}{"x"},
+		},
+		{
+			"quoted identifier containing a question mark",
+			pg.Build().Se("*").Fr("t").WR("a", "=", `"why?" || ?`, true, "x").Wh("b", "y"),
+			`select * from "t" where "a" = "why?" || $1 and "b" = $2`,
+			[]interface{}{"x", "y"},
+		},
+		{
+			"raw and bound values numbered in order",
+			pg.Build().Se("*").Fr("t").Wh("a", "1").WR("b", "in", "(?, ?)", true, 2, 3).Wh("c", "4"),
+			`select * from "t" where "a" = $1 and "b" in ($2, $3) and "c" = $4`,
+			[]interface{}{"1", int64(2), int64(3), "4"},
+		},
+		{
+			"update values come before where values",
+			pg.Build().Up("t", "name", "a?b").Wh("id", "1"),
+			`update "t" set "name" = $1 where "id" = $2`,
+			[]interface{}{"a?b", "1"},
+		},
+		{
+			"insert values",
+			pg.Build().Ins("t", 1, "?", true).(QueryBuilder),
+			`insert into "t" values ($1,$2,$3)`,
+			[]interface{}{int64(1), "?", int64(1)},
+		},
+		{
+			"sqlite keeps question marks",
+			lite.Build().Se("*").Fr("t").Wh("a", "1").WR("b", "in", "(?, ?)", true, 2, 3),
+			`select * from "t" where "a" = ? and "b" in (?, ?)`,
+			[]interface{}{"1", int64(2), int64(3)},
+		},
+		{
+			"typed values keep their type",
+			pg.Build().UpV("t", "admin", false).WhV("age", uint8(12)).WrV("score", ">=", 1.5).WhV("note", nil),
+			`update "t" set "admin" = $1 where "age" = $2 and "score" >= $3 and "note" = $4`,
+			[]interface{}{int64(0), int64(12), 1.5, nil},
+		},
+		{
+			"nested conditions",
+			pg.Build().Se("*").Fr("t").Wh("x", "1").WhereAny(Eq("a", 1), AllOf(C("b", ">", 2), Not(C("c", "<", 3)))),
+			`select * from "t" where "x" = $1 and ("a" = $2 or ("b" > $3 and not ("c" < $4)))`,
+			[]interface{}{"1", int64(1), int64(2), int64(3)},
+		},
+		{
+			"negated and empty groups",
+			lite.Build().Del("t").Where(Not(AnyOf(Eq("a", true), Eq("b", nil))), AnyOf(), AllOf()),
+			`delete from "t" where not ("a" = ? or "b" = ?) and 1 = 0 and 1 = 1`,
+			[]interface{}{int64(1), nil},
+		},
+		{
+			"in expands a slice",
+			pg.Build().Se("*").Fr("t").Where(In("id", []int{4, 5, 6}), NotIn("name", []string{}), In("b", []byte("x"))),
+			`select * from "t" where "id" in ($1, $2, $3) and 1 = 1 and "b" in ($4)`,
+			[]interface{}{int64(4), int64(5), int64(6), []byte("x")},
+		},
+		{
+			"between, null and like",
+			pg.Build().Se("*").Fr("t").Where(Between("age", 3, 9), IsNull("a"), IsNotNull("b"), Like("c", "x%"), ILike("d", "y%")),
+			`select * from "t" where "age" between $1 and $2 and "a" is null and "b" is not null and "c" like $3 and "d" ilike $4`,
+			[]interface{}{int64(3), int64(9), "x%", "y%"},
+		},
+		{
+			"sqlite ilike",
+			lite.Build().Se("*").Fr("t").Where(ILike("d", "y%"), In("e", 1)),
+			`select * from "t" where "d" like ? collate nocase and "e" in (?)`,
+			[]interface{}{"y%", int64(1)},
+		},
+		{
+			"joins",
+			pg.Build().Se("u.name, count(p.id)").Fr("users u").Join("posts p", On("p.user_id", "u.id"), C("p.draft", "=", false)).LeftJoin("teams t", C("t.id", "=", Col("u.team_id"))).CrossJoin("colors").Wh("u.name", "x").Or("u.name", "").Lm(5),
+			`select "u"."name", count("p"."id") from "users" as "u" join "posts" as "p" on "p"."user_id" = "u"."id" and "p"."draft" = $1 left join "teams" as "t" on "t"."id" = "u"."team_id" cross join "colors" where "u"."name" = $2 order by "u"."name" asc limit 5`,
+			[]interface{}{int64(0), "x"},
+		},
+		{
+			"right join",
+			lite.Build().Se("*").Fr("a").RightJoin("b", On("a.id", "b.a_id")),
+			`select * from "a" right join "b" on "a"."id" = "b"."a_id"`,
+			nil,
+		},
+		{
+			"group by and having",
+			pg.Build().Se("age, count(*)").Fr("t").Wh("admin", "0").GroupBy("age", "lower(name)").Having(C("count(*)", ">", 2), C("max(id)", "<", 100)).Or("age", "desc"),
+			`select "age", count(*) from "t" where "admin" = $1 group by "age", lower("name") having count(*) > $2 and max("id") < $3 order by "age" desc`,
+			[]interface{}{"0", int64(2), int64(100)},
+		},
+		{
+			"chained set",
+			pg.Build().Up("t", "name", "a").Set("age", 3).Set("admin", true).Wh("id", "1"),
+			`update "t" set "name" = $1, "age" = $2, "admin" = $3 where "id" = $4`,
+			[]interface{}{"a", int64(3), int64(1), "1"},
+		},
+		{
+			"update from a struct",
+			pg.Build().UpI("t", &testRow{7, "b", false, 0}),
+			`update "t" set "name" = $1, "admin" = $2, "age" = $3 where "id" = $4`,
+			[]interface{}{"b", int64(0), int64(0), int64(7)},
+		},
+		{
+			"update selected fields",
+			pg.Build().UpI("t", testRow{7, "b", false, 0}, "age", "name"),
+			`update "t" set "name" = $1, "age" = $2 where "id" = $3`,
+			[]interface{}{"b", int64(0), int64(7)},
+		},
+		{
+			"update non-zero fields",
+			pg.Build().UpINZ("t", &testRow{7, "b", false, 0}),
+			`update "t" set "name" = $1 where "id" = $2`,
+			[]interface{}{"b", int64(7)},
+		},
+		{
+			"upsert",
+			pg.Build().Upsert("t", &testRow{7, "b", true, 3}, []string{"id"}, nil).(QueryBuilder),
+			`insert into "t" ("id", "name", "admin", "age") values ($1,$2,$3,$4) on conflict ("id") do update set "name" = excluded."name", "admin" = excluded."admin", "age" = excluded."age"`,
+			[]interface{}{int64(7), "b", int64(1), int64(3)},
+		},
+		{
+			"insert or ignore",
+			lite.Build().InsIgnore("t", &testRow{0, "b", true, 3}).(QueryBuilder),
+			`insert into "t" ("name", "admin", "age") values (?,?,?) on conflict do nothing`,
+			[]interface{}{"b", int64(1), int64(3)},
+		},
+		{
+			"mysql upsert",
+			my.Build().Upsert("t", &testRow{7, "b", true, 3}, []string{"id"}, []string{"name"}).(QueryBuilder),
+			"insert into `t` (`id`, `name`, `admin`, `age`) values (?,?,?,?) on duplicate key update `name` = values(`name`)",
+			[]interface{}{int64(7), "b", int64(1), int64(3)},
+		},
+		{
+			"mysql insert ignore",
+			my.Build().InsIgnore("t", &testRow{7, "b", true, 3}).(QueryBuilder),
+			"insert ignore into `t` (`id`, `name`, `admin`, `age`) values (?,?,?,?)",
+			[]interface{}{int64(7), "b", int64(1), int64(3)},
+		},
+		{
+			"insert by column name",
+			lite.Build().InsI("t", &struct {
+				ID     int64  `json:"id"`
+				Hidden string `json:"-"`
+				Name   string `json:"name,omitempty"`
+				Skip   int
+			}{1, "x", "b", 2}).(QueryBuilder),
+			`insert into "t" ("id", "name") values (?,?)`,
+			[]interface{}{int64(1), "b"},
+		},
+		{
+			"insert by column name leaves out a zero id",
+			lite.Build().InsI("t", &testRow{0, "b", true, 3}).(QueryBuilder),
+			`insert into "t" ("name", "admin", "age") values (?,?,?)`,
+			[]interface{}{"b", int64(1), int64(3)},
+		},
+		{
+			"insert a map",
+			lite.Build().InsI("t", map[string]interface{}{"name": "b", "age": 3, "admin": true}).(QueryBuilder),
+			`insert into "t" ("admin", "age", "name") values (?,?,?)`,
+			[]interface{}{int64(1), int64(3), "b"},
+		},
+		{
+			"insert many rows",
+			&queryBuilder{d: pg, k: kindInsert, t: "t", ic: []string{"a", "b"}, iv: []interface{}{1, 2}, im: [][]interface{}{{3, 4}, {5, 6}}},
+			`insert into "t" ("a", "b") values ($1,$2),($3,$4),($5,$6)`,
+			[]interface{}{int64(1), int64(2), int64(3), int64(4), int64(5), int64(6)},
+		},
+		{
+			"returning",
+			pg.Build().Up("t", "name", "a").Wh("id", "1").Returning("id", "name"),
+			`update "t" set "name" = $1 where "id" = $2 returning "id", "name"`,
+			[]interface{}{"a", "1"},
+		},
+		{
+			"returning from a delete",
+			lite.Build().Del("t").Wh("id", "1").Returning("*"),
+			`delete from "t" where "id" = ? returning *`,
+			[]interface{}{"1"},
+		},
+		{
+			"query by example",
+			pg.Build().Se("*").Fr("t").Where(ExampleConds(testRow{Name: "Bo", Age: 4}, ExampleOptions{})...),
+			`select * from "t" where "name" = $1 and "age" = $2`,
+			[]interface{}{"Bo", int64(4)},
+		},
+		{
+			"query by example with like and a time window",
+			pg.Build().Se("*").Fr("t").Where(ExampleConds(&struct {
+				Name string    `json:"name"`
+				At   time.Time `json:"at"`
+			}{"bo", time.Unix(100, 0)}, ExampleOptions{true, time.Second})...),
+			`select * from "t" where "name" ilike $1 escape '!' and "at" between $2 and $3`,
+			[]interface{}{"%bo%", time.Unix(99, 0), time.Unix(101, 0)},
+		},
+		{
+			"query by example escapes like wildcards",
+			my.Build().Se("*").Fr("t").Where(ExampleConds(testRow{Name: "50%_off!"}, ExampleOptions{LikeStrings: true})...),
+			"select * from `t` where lower(`name`) like lower(?) escape '!'",
+			[]interface{}{"%50!%!_off!!%"},
+		},
+		{
+			"query by example of a nil pointer or a map",
+			pg.Build().Se("*").Fr("t").Where(append(ExampleConds((*testRow)(nil), ExampleOptions{}), ExampleConds(map[string]interface{}{"name": "bo"}, ExampleOptions{})...)...),
+			`select * from "t"`,
+			nil,
+		},
+		{
+			"seek with a row comparison",
+			pg.Build().Se("*").Fr("t").Where(&seekCond{[]string{"a", "id"}, []bool{false, false}, []cursorValue{{"s", "x"}, {"i", "3"}}, false}),
+			`select * from "t" where ("a", "id") > ($1, $2)`,
+			[]interface{}{"x", int64(3)},
+		},
+		{
+			"seek expanded for mixed directions",
+			pg.Build().Se("*").Fr("t").Where(&seekCond{[]string{"a", "id"}, []bool{true, false}, []cursorValue{{"f", "1.5"}, {"i", "3"}}, true}),
+			`select * from "t" where (("a" > $1) or ("a" = $2 and "id" < $3))`,
+			[]interface{}{1.5, 1.5, int64(3)},
+		},
+		{
+			"seek expanded on sqlite",
+			lite.Build().Se("*").Fr("t").Where(&seekCond{[]string{"id"}, []bool{false}, []cursorValue{{"i", "3"}}, false}),
+			`select * from "t" where (("id" > ?))`,
+			[]interface{}{int64(3)},
+		},
+	}
+	for _, c := range cases {
+		q, args, err := c.qb.(*queryBuilder).query()
+		if err != nil {
+			t.Errorf("%s: %v", c.name, err)
+			continue
+		}
+		if q != c.q {
+			t.Errorf("%s:\n got %s\nwant %s", c.name, q, c.q)
+		}
+		if len(args) != 0 || len(c.args) != 0 {
+			if !reflect.DeepEqual(args, c.args) {
+				t.Errorf("%s: got args %#v, want %#v", c.name, args, c.args)
+			}
+		}
+	}
+}
+
+func TestIdentifiers(t *testing.T) {
+	lite := &DbProxy{dialect: sqliteDialect{}}
+	my := &DbProxy{dialect: mysqlDialect{}}
+
+	valid := []struct {
+		qb QueryBuilder
+		q  string
+	}{
+		{lite.Build().Se("count(*)").Fr("New_Tablee"), `select count(*) from "New_Tablee"`},
+		{lite.Build().Se("id, u.name as n, max(t.age) oldest").Fr("users u"), `select "id", "u"."name" as "n", max("t"."age") as "oldest" from "users" as "u"`},
+		{lite.Build().Se("distinct t.*").Fr("t").Or("id", "DESC").Or("name", ""), `select distinct "t".* from "t" order by "id" desc, "name" asc`},
+		{my.Build().Se("count(distinct name)").Fr("t").Wr("lower(name)", "not like", "x"), "select count(distinct `name`) from `t` where lower(`name`) not like ?"},
+	}
+	for _, c := range valid {
+		q, _, err := c.qb.(*queryBuilder).query()
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if q != c.q {
+			t.Errorf("\n got %s\nwant %s", q, c.q)
+		}
+	}
+
+	invalid := []QueryBuilder{
+		lite.Build().Se("*").Fr("t; drop table t"),
+		lite.Build().Se("*").Fr("t").Wh("a = 1 or 1", "1"),
+		lite.Build().Se("*").Fr("t").Wr("a", "= 1 or a", "1"),
+		lite.Build().Se("*").Fr("t").Or("id", "desc; drop table t"),
+		lite.Build().Se("*").Fr("t").Wr("id", "--", "1").Wh("tenant", "7"),
+		lite.Build().Se("*").Fr("t").Wr("id", "/*", "1"),
+		lite.Build().Se("*").Fr("t").Wr("data", "?", "k"),
+		my.Build().Se("*").Fr("t").Wr("data", "@>", "k"),
+		lite.Build().Se("name, (select password from users)").Fr("t"),
+		lite.Build().Up("t", `a" = 1, "b`, "1"),
+		lite.Build().Se("*").Fr("t").Where(ILike("d) or (1", "y%")),
+		lite.Build().Se("*").Fr("t").Join("u on 1=1"),
+		lite.Build().UpI("t", testRow{}, "missing"),
+		lite.Build().UpINZ("t", testRow{}),
+		lite.Build().Upsert("t", testRow{}, nil, nil).(QueryBuilder),
+		lite.Build().Upsert("t", testRow{}, []string{"id) do nothing; --"}, nil).(QueryBuilder),
+		lite.Build().UpI("t", struct {
+			Name string `json:"name"`
+		}{}),
+		lite.Build().Se("*").Fr("t").Where(C("a", "=", Col("b; drop table t"))),
+		my.Build().Se("*").Fr("t").Where(C("sleep(10)", "=", 1)),
+		lite.Build().Se("*").Fr("t").Or("randomblob(1)", "asc"),
+		lite.Build().Se("max(randomblob(1))").Fr("t"),
+	}
+	invalid = append(invalid, lite.Build().Se("*").Fr("t").WhV("a", struct{}{}))
+	for _, qb := range invalid {
+		if q, _, err := qb.(*queryBuilder).query(); err == nil {
+			t.Error("expected an error for", q)
+		}
+	}
+
+	if q := (postgresDialect{}).QuoteIdent(`New"Table`); q != `"new""table"` {
+		t.Error("postgres must lowercase and escape identifiers, got", q)
+	}
+}
+
+func TestManyColumns(t *testing.T) {
+	cols, rows, err := manyColumns([]*testRow{{0, "a", true, 1}, {0, "b", false, 2}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(cols, []string{"name", "admin", "age"}) || len(rows) != 2 || rows[1][0] != "b" {
+		t.Error("expected the zero id to be left out of every row, got", cols, rows)
+	}
+	if _, _, err := manyColumns([]*testRow{{0, "a", true, 1}, {50, "b", false, 2}}); err == nil {
+		t.Error("expected an error for rows mixing zero and explicit ids")
+	}
+	if _, _, err := manyColumns([]testRow{{50, "a", true, 1}, {0, "b", false, 2}}); err == nil {
+		t.Error("expected an error for rows mixing explicit and zero ids")
+	}
+	if _, _, err := manyColumns([]map[string]interface{}{{"a": 1}, {"b": 2}}); err == nil {
+		t.Error("expected an error for rows with different columns")
+	}
+	if _, _, err := manyColumns(testRow{}); err == nil {
+		t.Error("expected an error for rows that are not a slice")
+	}
+}
+
+func TestStructPrimaryKey(t *testing.T) {
+	db := &Outer{&DbProxy{dialect: postgresDialect{}}}
+	cases := []struct {
+		v  interface{}
+		pk string
+	}{
+		{testRow{}, db.AutoIncrementPrimaryKey()},
+		{struct {
+			ID int64 `json:"id" dbsorm:"assigned"`
+		}{}, db.IntPrimaryKey()},
+		{struct {
+			ID string `json:"id"`
+		}{}, db.UUIDPrimaryKey()},
+	}
+	for _, c := range cases {
+		if pk := db.structPrimaryKey(c.v); pk != c.pk {
+			t.Errorf("%T: got %s, want %s", c.v, pk, c.pk)
+		}
+	}
+	cols, err := db.structColumns(struct {
+		ID   int64  `json:"id" dbsorm:"assigned"`
+		Name string `json:"name" dbsorm:"1"`
+	}{})
+	if err != nil || len(cols) != 1 || cols[0][0] != "name" {
+		t.Error("expected the id to be left out of the columns, got", cols, err)
+	}
+}
+
+func TestQueryTableInfo(t *testing.T) {
+	for _, db := range []*DbProxy{{dialect: postgresDialect{}}, {dialect: mysqlDialect{}}} {
+		if _, err := db.QueryTableInfoE("t"); err == nil {
+			t.Error("expected an error from QueryTableInfo on", db.DriverName())
+		}
+	}
+}
+
+func TestInsManyTooManyColumns(t *testing.T) {
+	row := map[string]interface{}{}
+	for i := 0; i < 1000; i++ {
+		row["c"+strconv.Itoa(i)] = i
+	}
+	lite := &DbProxy{dialect: sqliteDialect{}}
+	if _, err := lite.Build().InsMany("t", []map[string]interface{}{row}); err == nil {
+		t.Error("expected an error for more columns than sqlite can bind")
+	}
+}
+
+func TestEmulatedReturningNeedsTx(t *testing.T) {
+	my := &DbProxy{dialect: mysqlDialect{}}
+	if _, err := my.Build().Up("t", "name", "x").Wh("id", "1").Returning("id").ExeE(); err == nil {
+		t.Error("expected an error from emulated returning outside of a transaction")
+	}
+}
@@ -0,0 +1,226 @@
+package dbstorage
+
+import (
+	"reflect"
+	"strings"
+)
+
+// Cond is one condition of a where clause. Conditions nest, so any boolean expression
+// such as a = ? or (b > ? and not c < ?) can be built from them.
+type Cond interface {
+	render(r *renderer)
+}
+
+// Col is a column name used as the value of a condition, so it is compared to another column instead of bound.
+type Col string
+
+// On is C(left, "=", Col(right)), the usual condition of a join.
+func On(left string, right string) Cond {
+	return C(left, "=", Col(right))
+}
+
+// C compares col to a bound value with op, or to another column if value is a Col.
+func C(col string, op string, value interface{}) Cond {
+	return &cmpCond{col, op, value}
+}
+
+// Eq is C(col, "=", value).
+func Eq(col string, value interface{}) Cond {
+	return C(col, "=", value)
+}
+
+// AnyOf matches when any of conds do. With no conds it matches nothing.
+func AnyOf(conds ...Cond) Cond {
+	return &groupCond{" or ", "1 = 0", conds}
+}
+
+// AllOf matches when all of conds do. With no conds it matches everything.
+func AllOf(conds ...Cond) Cond {
+	return &groupCond{" and ", "1 = 1", conds}
+}
+
+// Not matches when c does not.
+func Not(c Cond) Cond {
+	return &notCond{c}
+}
+
+// In matches when col is one of the items of the slice values. With no items it matches nothing.
+func In(col string, values interface{}) Cond {
+	return &inCond{col, "in", "1 = 0", listOf(values)}
+}
+
+// NotIn matches when col is none of the items of the slice values. With no items it matches everything.
+func NotIn(col string, values interface{}) Cond {
+	return &inCond{col, "not in", "1 = 1", listOf(values)}
+}
+
+// Between matches when col is from lo to hi, inclusive.
+func Between(col string, lo interface{}, hi interface{}) Cond {
+	return &betweenCond{col, lo, hi}
+}
+
+// IsNull matches when col is null.
+func IsNull(col string) Cond {
+	return &nullCond{col, "is null"}
+}
+
+// IsNotNull matches when col is not null.
+func IsNotNull(col string) Cond {
+	return &nullCond{col, "is not null"}
+}
+
+// Like matches col against the pattern with like, whether case matters depends on the backend.
+func Like(col string, pattern string) Cond {
+	return C(col, "like", pattern)
+}
+
+// ILike matches col against the pattern ignoring case on every backend.
+func ILike(col string, pattern string) Cond {
+	return &ilikeCond{col, pattern, false}
+}
+
+// listOf returns the items of the slice or array values, anything else is a list of one.
+func listOf(values interface{}) []interface{} {
+	v := reflect.ValueOf(values)
+	if (v.Kind() != reflect.Slice && v.Kind() != reflect.Array) || v.Type().Elem().Kind() == reflect.Uint8 {
+		return []interface{}{values}
+	}
+	result := make([]interface{}, v.Len())
+	for i := range result {
+		result[i] = v.Index(i).Interface()
+	}
+	return result
+}
+
+//
+//
+
+type cmpCond struct {
+	col   string
+	op    string
+	value interface{}
+}
+
+func (c *cmpCond) render(r *renderer) {
+	r.expr(c.col)
+	r.op(c.op)
+	if col, ok := c.value.(Col); ok {
+		r.expr(string(col))
+		return
+	}
+	r.bind(c.value)
+}
+
+// rawCond is a where clause from WR with raw set, value is written as SQL with args bound to its ?'s.
+type rawCond struct {
+	col   string
+	op    string
+	value string
+	args  []interface{}
+}
+
+func (c *rawCond) render(r *renderer) {
+	r.expr(c.col)
+	r.op(c.op)
+	r.fragment(c.value, c.args)
+}
+
+type groupCond struct {
+	sep   string
+	empty string
+	conds []Cond
+}
+
+func (c *groupCond) render(r *renderer) {
+	if len(c.conds) == 0 {
+		r.raw(c.empty)
+		return
+	}
+	r.raw("(")
+	r.join(c.conds, c.sep)
+	r.raw(")")
+}
+
+type notCond struct {
+	c Cond
+}
+
+func (c *notCond) render(r *renderer) {
+	if g, ok := c.c.(*groupCond); ok && len(g.conds) > 0 {
+		r.raw("not ")
+		g.render(r)
+		return
+	}
+	r.raw("not (")
+	c.c.render(r)
+	r.raw(")")
+}
+
+type inCond struct {
+	col    string
+	op     string
+	empty  string
+	values []interface{}
+}
+
+func (c *inCond) render(r *renderer) {
+	if len(c.values) == 0 {
+		r.raw(c.empty)
+		return
+	}
+	r.expr(c.col)
+	r.raw(" " + c.op + " (")
+	for i, item := range c.values {
+		if i > 0 {
+			r.raw(", ")
+		}
+		r.bind(item)
+	}
+	r.raw(")")
+}
+
+type betweenCond struct {
+	col string
+	lo  interface{}
+	hi  interface{}
+}
+
+func (c *betweenCond) render(r *renderer) {
+	r.expr(c.col)
+	r.raw(" between ")
+	r.bind(c.lo)
+	r.raw(" and ")
+	r.bind(c.hi)
+}
+
+type nullCond struct {
+	col string
+	op  string
+}
+
+func (c *nullCond) render(r *renderer) {
+	r.expr(c.col)
+	r.raw(" " + c.op)
+}
+
+// likeEscaper makes s match itself literally in a pattern with ! as the escape character.
+var likeEscaper = strings.NewReplacer("!", "!!", "%", "!%", "_", "!_")
+
+// likeEscape is the escape clause Dialect.ILike ends with when escape is set.
+func likeEscape(escape bool) string {
+	if escape {
+		return " escape '!'"
+	}
+	return ""
+}
+
+type ilikeCond struct {
+	col     string
+	pattern string
+	escape  bool // ! escapes %, _, and ! in pattern
+}
+
+func (c *ilikeCond) render(r *renderer) {
+	col, err := quoteExpr(r.d, c.col)
+	r.quoted(r.d.ILike(col, r.placeholder(c.pattern), c.escape), err)
+}
@@ -1,9 +1,13 @@
 package dbstorage
 
 import (
+	"context"
 	"database/sql"
 	"reflect"
+	"sort"
+	"strings"
 
+	"github.com/nektro/go-util/arrays/stringsu"
 	"github.com/nektro/go-util/util"
 
 	. "github.com/nektro/go-util/alias"
@@ -13,22 +17,45 @@ import (
 type Database interface {
 	Inner
 	CreateTableStruct(name string, v interface{})
+	CreateTableStructE(name string, v interface{}) error
+	CreateTableStructContext(ctx context.Context, name string, v interface{}) error
+	WithTx(f func(Tx) error) error
+	WithTxContext(ctx context.Context, opts *sql.TxOptions, f func(Tx) error) error
+	FindByExample(table string, example interface{}, opts ExampleOptions) QueryBuilder
 }
 
 type Inner interface {
 	Ping() error
+	PingContext(ctx context.Context) error
 	Close() error
 	DB() *sql.DB
+	Dialect() Dialect
+	Begin() (Tx, error)
+	BeginTx(ctx context.Context, opts *sql.TxOptions) (Tx, error)
 	CreateTable(name string, pk []string, columns [][]string)
+	CreateTableE(name string, pk []string, columns [][]string) error
+	CreateTableContext(ctx context.Context, name string, pk []string, columns [][]string) error
 	DoesTableExist(table string) bool
+	DoesTableExistE(table string) (bool, error)
+	DoesTableExistContext(ctx context.Context, table string) (bool, error)
 	Build() QueryBuilder
 	QueryColumnList(table string) []string
+	QueryColumnListE(table string) ([]string, error)
+	QueryColumnListContext(ctx context.Context, table string) ([]string, error)
 	QueryNextID(table string) int64
+	QueryNextIDE(table string) (int64, error)
+	QueryNextIDContext(ctx context.Context, table string) (int64, error)
 	QueryRowCount(table string) int64
+	QueryRowCountE(table string) (int64, error)
+	QueryRowCountContext(ctx context.Context, table string) (int64, error)
 	DropTable(name string)
+	DropTableE(name string) error
+	DropTableContext(ctx context.Context, name string) error
 	DriverName() string
 	TagName() string
 	IntPrimaryKey() string
+	AutoIncrementPrimaryKey() string
+	UUIDPrimaryKey() string
 	TypeForType(reflect.Type) string
 }
 
@@ -37,12 +64,50 @@ type Outer struct {
 }
 
 func (db *Outer) CreateTableStruct(name string, v interface{}) {
+	cols, err := db.structColumns(v)
+	util.DieOnError(err)
+	db.CreateTable(name, []string{"id", db.structPrimaryKey(v)}, cols)
+}
+
+// CreateTableStructE is CreateTableStruct but returns unknown field types and database errors instead of exiting.
+func (db *Outer) CreateTableStructE(name string, v interface{}) error {
+	return db.CreateTableStructContext(context.Background(), name, v)
+}
+
+func (db *Outer) CreateTableStructContext(ctx context.Context, name string, v interface{}) error {
+	cols, err := db.structColumns(v)
+	if err != nil {
+		return err
+	}
+	return db.CreateTableContext(ctx, name, []string{"id", db.structPrimaryKey(v)}, cols)
+}
+
+// structPrimaryKey picks UUIDPrimaryKey for string ids and AutoIncrementPrimaryKey otherwise. Integer ids
+// tagged `dbsorm:"assigned"` get IntPrimaryKey instead, for tables whose ids always come from the application,
+// such as QueryNextID or an IDGenerator. PostgreSQL does not advance an identity column when a row is inserted
+// with an explicit id, so a table should not mix generated and explicit ids there.
+func (db *Outer) structPrimaryKey(v interface{}) string {
+	f, ok := structField(reflect.TypeOf(v), "id")
+	if ok && f.Type.Kind() == reflect.String {
+		return db.UUIDPrimaryKey()
+	}
+	if ok && f.Tag.Get("dbsorm") == "assigned" {
+		return db.IntPrimaryKey()
+	}
+	return db.AutoIncrementPrimaryKey()
+}
+
+func (db *Outer) structColumns(v interface{}) ([][]string, error) {
 	t := reflect.TypeOf(v)
 	vv := reflect.ValueOf(v)
 	cols := [][]string{}
 	for i := 0; i < t.NumField(); i++ {
 		f := t.Field(i)
 		ftj := f.Tag.Get("json")
+		if ftj == "id" {
+			// made by CreateTable from structPrimaryKey
+			continue
+		}
 		g := f.Tag.Get(db.TagName())
 		if len(g) > 0 {
 			cols = append(cols, []string{ftj, g})
@@ -54,8 +119,134 @@ func (db *Outer) CreateTableStruct(name string, v interface{}) {
 				cols = append(cols, []string{ftj, g})
 				continue
 			}
-			util.DieOnError(E("dbstorage: unknown struct field type:"), F("%v", vfi), ftj)
+			return nil, E(F("dbstorage: unknown struct field type: %v %s", vfi, ftj))
+		}
+	}
+	return cols, nil
+}
+
+// insertColumns returns the json column names and values of the tagged fields in strct, leaving out skip.
+// strct may also be a map from column names to values, its columns are sorted so the query is the same each time.
+func insertColumns(strct interface{}, skip string) ([]string, []interface{}) {
+	v := reflect.Indirect(reflect.ValueOf(strct))
+	t := v.Type()
+	cols := []string{}
+	vals := []interface{}{}
+	if t.Kind() == reflect.Map {
+		for _, item := range v.MapKeys() {
+			if item.String() != skip {
+				cols = append(cols, item.String())
+			}
+		}
+		sort.Strings(cols)
+		for _, item := range cols {
+			vals = append(vals, v.MapIndex(reflect.ValueOf(item).Convert(t.Key())).Interface())
+		}
+		return cols, vals
+	}
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		if len(name) == 0 || name == "-" || name == skip {
+			continue
+		}
+		cols = append(cols, name)
+		vals = append(vals, v.Field(i).Interface())
+	}
+	return cols, vals
+}
+
+// manyColumns is insertColumns for each struct or map in the slice rows, which must all have the same columns.
+// The id is left out if it is zero, which must then be so in every row.
+func manyColumns(rows interface{}) ([]string, [][]interface{}, error) {
+	v := reflect.ValueOf(rows)
+	if v.Kind() != reflect.Slice {
+		return nil, nil, E(F("dbstorage: expected a slice of rows, got %T", rows))
+	}
+	if v.Len() == 0 {
+		return nil, nil, nil
+	}
+	skip := ""
+	first := reflect.Indirect(v.Index(0))
+	if sf, ok := structField(first.Type(), "id"); ok && first.FieldByIndex(sf.Index).IsZero() {
+		skip = "id"
+	}
+	var cols []string
+	result := [][]interface{}{}
+	for i := 0; i < v.Len(); i++ {
+		row := reflect.Indirect(v.Index(i))
+		if sf, ok := structField(row.Type(), "id"); ok && row.FieldByIndex(sf.Index).IsZero() != (skip == "id") {
+			return nil, nil, E(F("dbstorage: row %d of %T mixes zero and explicit ids with row 0", i, rows))
+		}
+		c, vals := insertColumns(v.Index(i).Interface(), skip)
+		if i == 0 {
+			cols = c
+		} else if strings.Join(c, ",") != strings.Join(cols, ",") {
+			return nil, nil, E(F("dbstorage: row %d has columns %v instead of %v", i, c, cols))
 		}
+		result = append(result, vals)
+	}
+	if len(cols) == 0 {
+		return nil, nil, E(F("dbstorage: no columns to insert from %T", rows))
+	}
+	return cols, result, nil
+}
+
+// updateColumns is insertColumns without the id, limited to the columns in only if there are any,
+// and to the fields that are not their zero value if nonZero is set. It also returns the value of the id.
+func updateColumns(strct interface{}, only []string, nonZero bool) ([]string, []interface{}, interface{}, error) {
+	v := reflect.Indirect(reflect.ValueOf(strct))
+	sf, ok := structField(v.Type(), "id")
+	if !ok {
+		return nil, nil, nil, E(F("dbstorage: %v has no id field to update by", v.Type()))
+	}
+	cols := []string{}
+	vals := []interface{}{}
+	for i := 0; i < v.NumField(); i++ {
+		name := strings.Split(v.Type().Field(i).Tag.Get("json"), ",")[0]
+		if len(name) == 0 || name == "-" || name == "id" {
+			continue
+		}
+		if len(only) > 0 && !stringsu.Contains(only, name) {
+			continue
+		}
+		if nonZero && v.Field(i).IsZero() {
+			continue
+		}
+		cols = append(cols, name)
+		vals = append(vals, v.Field(i).Interface())
+	}
+	for _, item := range only {
+		if !stringsu.Contains(cols, item) {
+			return nil, nil, nil, E(F("dbstorage: %v has no field for column %s", v.Type(), item))
+		}
+	}
+	return cols, vals, v.FieldByIndex(sf.Index).Interface(), nil
+}
+
+// structField finds the field of t whose json tag names col, there is none if t is not a struct.
+func structField(t reflect.Type, col string) (reflect.StructField, bool) {
+	if t.Kind() != reflect.Struct {
+		return reflect.StructField{}, false
+	}
+	for i := 0; i < t.NumField(); i++ {
+		if strings.Split(t.Field(i).Tag.Get("json"), ",")[0] == col {
+			return t.Field(i), true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+// setStructID stores id in the field tagged `json:"id"` when strct is a pointer to a struct.
+func setStructID(strct interface{}, id int64) {
+	v := reflect.ValueOf(strct)
+	if v.Kind() != reflect.Ptr {
+		return
+	}
+	sf, ok := structField(v.Elem().Type(), "id")
+	if !ok {
+		return
+	}
+	if f := v.Elem().FieldByIndex(sf.Index); f.CanSet() && f.Kind() >= reflect.Int && f.Kind() <= reflect.Int64 {
+		f.SetInt(id)
 	}
-	db.CreateTable(name, []string{"id", db.IntPrimaryKey()}, cols)
 }
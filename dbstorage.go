@@ -20,6 +20,9 @@ func init() {
 
 var (
 	// InsertsLock - use this so that Database.QueryNextID and DataBase.Build.Ins happen in an atomic fashion.
+	//
+	// Deprecated: InsertsLock only guards a single process. Tables made by CreateTableStruct
+	// have database-assigned ids, insert into them with QueryBuilder.InsID instead.
 	InsertsLock = new(sync.Mutex)
 )
 
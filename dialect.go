@@ -0,0 +1,87 @@
+package dbstorage
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"reflect"
+	"strings"
+)
+
+// Dialect holds everything that differs between the supported SQL backends.
+// The shared DbProxy and query builder defer to it whenever the generated SQL is not portable.
+type Dialect interface {
+	// DriverName is the name this backend is known by.
+	DriverName() string
+	// TagName is the struct tag CreateTableStruct reads explicit column types from.
+	TagName() string
+
+	// Placeholder is the marker for the nth bound value of a statement, starting from 1.
+	Placeholder(n int) string
+	// BackslashEscapes reports whether a backslash escapes the next character inside a quoted string.
+	BackslashEscapes() bool
+	// QuoteIdent quotes a single table or column name so it can never be read as SQL.
+	QuoteIdent(name string) string
+
+	IntPrimaryKey() string
+	AutoIncrementPrimaryKey() string
+	UUIDPrimaryKey() string
+	// TypeForType maps a Go type to a column type, or returns an empty string if there is none.
+	TypeForType(t reflect.Type) string
+
+	CreateTable(name string, pk string, pkType string) string
+	AddColumn(table string, col string, typ string) string
+	DropTable(name string) string
+	// TableExists is a query and its arguments that returns a row only if table exists.
+	TableExists(table string) (string, []interface{})
+	// ColumnList is a query and its arguments that returns the name of each column in table.
+	ColumnList(table string) (string, []interface{})
+	// Savepoint returns the statements to create, release, and roll back to the savepoint name.
+	Savepoint(name string) (create, release, rollback string)
+	// MaxParams is the most values that can be bound to one statement.
+	MaxParams() int
+	// LastInsertID reports whether sql.Result.LastInsertId works, otherwise inserts use "returning id".
+	LastInsertID() bool
+	// Returning reports whether insert, update, and delete can end in "returning", otherwise it is emulated.
+	Returning() bool
+	// Upsert returns how to begin an insert and what to add after its values so that a row conflicting on
+	// the already quoted conflict columns has the update columns set to the new values instead. With no
+	// update columns the conflicting row is left alone.
+	Upsert(conflict []string, update []string) (insert string, suffix string)
+	// RowValues reports whether Paginate compares its order columns as a row such as (a, b) > (?, ?),
+	// otherwise the comparison is expanded into a > ? or (a = ? and b > ?).
+	RowValues() bool
+	// ILike is a case-insensitive like between the already quoted col and placeholder value. With escape, ! is
+	// the escape character, since a backslash would need quoting differently on each backend.
+	ILike(col string, value string, escape bool) string
+}
+
+// copier is implemented by dialects with a faster way to load many rows than insert.
+type copier interface {
+	CopyIn(ctx context.Context, tx *sql.Tx, table string, cols []string, rows [][]interface{}) error
+}
+
+// onConflict is the upsert clause shared by SQLite and PostgreSQL.
+func onConflict(conflict []string, update []string) string {
+	if len(update) == 0 {
+		return " on conflict do nothing"
+	}
+	set := []string{}
+	for _, item := range update {
+		set = append(set, item+" = excluded."+item)
+	}
+	return " on conflict (" + strings.Join(conflict, ", ") + ") do update set " + strings.Join(set, ", ")
+}
+
+// typeForValuer maps types that implement driver.Valuer to the column type of the value they produce.
+func typeForValuer(d Dialect, t reflect.Type) string {
+	dv, ok := reflect.New(t).Interface().(driver.Valuer)
+	if ok {
+		v, _ := dv.Value()
+		if v == nil {
+			return ""
+		}
+		return d.TypeForType(reflect.TypeOf(v))
+	}
+	return ""
+}
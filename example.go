@@ -0,0 +1,53 @@
+package dbstorage
+
+import (
+	"reflect"
+	"strings"
+	"time"
+)
+
+// ExampleOptions changes how FindByExample matches the fields of its example.
+type ExampleOptions struct {
+	// LikeStrings matches string fields anywhere in the column, ignoring case, instead of exactly.
+	LikeStrings bool
+	// TimeWindow matches time fields within this much before or after, instead of exactly.
+	TimeWindow time.Duration
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// FindByExample selects the rows of table that match every field of example that is not its zero value.
+func (db *Outer) FindByExample(table string, example interface{}, opts ExampleOptions) QueryBuilder {
+	return db.Build().Se("*").Fr(table).Where(ExampleConds(example, opts)...)
+}
+
+// ExampleConds is a condition for each json tagged field of the struct example that is not its zero value,
+// so false and 0 can not be searched for. An example that is not a struct or a non-nil pointer to one has none.
+func ExampleConds(example interface{}, opts ExampleOptions) []Cond {
+	v := reflect.Indirect(reflect.ValueOf(example))
+	result := []Cond{}
+	if v.Kind() != reflect.Struct {
+		return result
+	}
+	for i := 0; i < v.NumField(); i++ {
+		f := v.Type().Field(i)
+		name := strings.Split(f.Tag.Get("json"), ",")[0]
+		if len(name) == 0 || name == "-" || f.PkgPath != "" || v.Field(i).IsZero() {
+			continue
+		}
+		fv := v.Field(i)
+		switch {
+		case opts.LikeStrings && fv.Kind() == reflect.String:
+			result = append(result, &ilikeCond{name, "%" + likeEscaper.Replace(fv.String()) + "%", true})
+		case opts.TimeWindow > 0 && fv.Type().ConvertibleTo(timeType) && fv.Kind() == reflect.Struct:
+			// the ends are converted back to the field's type so they are bound the same way the column was written
+			t := fv.Convert(timeType).Interface().(time.Time)
+			lo := reflect.ValueOf(t.Add(-opts.TimeWindow)).Convert(fv.Type()).Interface()
+			hi := reflect.ValueOf(t.Add(opts.TimeWindow)).Convert(fv.Type()).Interface()
+			result = append(result, Between(name, lo, hi))
+		default:
+			result = append(result, Eq(name, fv.Interface()))
+		}
+	}
+	return result
+}
@@ -0,0 +1,158 @@
+package dbstorage
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+)
+
+var (
+	identRe  = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	numberRe = regexp.MustCompile(`^-?[0-9]+(\.[0-9]+)?$`)
+	funcRe   = regexp.MustCompile(`^([A-Za-z_][A-Za-z0-9_]*)\s*\((.*)\)$`)
+	aliasRe  = regexp.MustCompile(`^(.*?)\s+(?i:as\s+)?([A-Za-z_][A-Za-z0-9_]*)$`)
+)
+
+var (
+	// keywordOperators are the word operators allowed in a where clause.
+	keywordOperators = []string{"like", "not like", "ilike", "not ilike", "glob", "regexp", "in", "not in", "is", "is not"}
+	// symbolOperators are the comparison operators allowed in a where clause.
+	symbolOperators = []string{"=", "<>", "!=", "<", "<=", ">", ">="}
+	// numberedOperators are the PostgreSQL JSON, array, and regex operators, which are only allowed with numbered
+	// placeholders since ? is one of them.
+	numberedOperators = []string{"@>", "<@", "?", "?|", "?&", "&&", "->", "->>", "#>", "#>>", "~", "~*", "!~", "!~*"}
+	// functions are the functions a column expression may call. Column names often come from requests, so
+	// ones that are slow or have side effects, such as sleep, are left out.
+	functions = []string{"count", "sum", "avg", "min", "max", "lower", "upper", "length", "trim", "abs", "round", "coalesce", "nullif"}
+)
+
+// quoteName quotes an identifier that may be qualified, such as table.column. The last part may be *.
+func quoteName(d Dialect, name string) (string, error) {
+	parts := strings.Split(strings.TrimSpace(name), ".")
+	for i, item := range parts {
+		if item == "*" && i == len(parts)-1 {
+			continue
+		}
+		if !identRe.MatchString(item) {
+			return "", errors.New("dbstorage: invalid identifier: " + name)
+		}
+		parts[i] = d.QuoteIdent(item)
+	}
+	return strings.Join(parts, "."), nil
+}
+
+// quoteExpr quotes a column reference, or a call of one of functions over column references such as count(*) or
+// max(t.id).
+func quoteExpr(d Dialect, expr string) (string, error) {
+	expr = strings.TrimSpace(expr)
+	if expr == "*" || numberRe.MatchString(expr) {
+		return expr, nil
+	}
+	m := funcRe.FindStringSubmatch(expr)
+	if m == nil {
+		return quoteName(d, expr)
+	}
+	if indexOf(functions, strings.ToLower(m[1])) < 0 {
+		return "", errors.New("dbstorage: function not allowed: " + expr)
+	}
+	inner := strings.TrimSpace(m[2])
+	prefix := ""
+	if len(inner) > 9 && strings.EqualFold(inner[:9], "distinct ") {
+		prefix = "distinct "
+		inner = inner[9:]
+	}
+	args := []string{}
+	if len(inner) > 0 {
+		for _, item := range splitTopLevel(inner) {
+			a, err := quoteExpr(d, item)
+			if err != nil {
+				return "", err
+			}
+			args = append(args, a)
+		}
+	}
+	return m[1] + "(" + prefix + strings.Join(args, ", ") + ")", nil
+}
+
+// quoteSelect quotes a comma separated list of quoteExpr's, each with an optional alias.
+func quoteSelect(d Dialect, list string) (string, error) {
+	list = strings.TrimSpace(list)
+	prefix := ""
+	if len(list) > 9 && strings.EqualFold(list[:9], "distinct ") {
+		prefix = "distinct "
+		list = list[9:]
+	}
+	result := []string{}
+	for _, item := range splitTopLevel(list) {
+		q, err := quoteAliased(d, item, quoteExpr)
+		if err != nil {
+			return "", err
+		}
+		result = append(result, q)
+	}
+	return prefix + strings.Join(result, ", "), nil
+}
+
+// quoteTable quotes a table name with an optional alias, such as "users u" or "users as u".
+func quoteTable(d Dialect, table string) (string, error) {
+	return quoteAliased(d, table, quoteName)
+}
+
+func quoteAliased(d Dialect, s string, quote func(Dialect, string) (string, error)) (string, error) {
+	s = strings.TrimSpace(s)
+	if m := aliasRe.FindStringSubmatch(s); m != nil {
+		q, err := quote(d, m[1])
+		if err != nil {
+			return "", err
+		}
+		return q + " as " + d.QuoteIdent(m[2]), nil
+	}
+	return quote(d, s)
+}
+
+// splitTopLevel splits s on the commas that are not inside parentheses.
+func splitTopLevel(s string) []string {
+	result := []string{}
+	depth := 0
+	start := 0
+	for i, c := range s {
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				result = append(result, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(result, s[start:])
+}
+
+// orderDirection only lets through ASC and DESC, empty means ascending.
+func orderDirection(order string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(order)) {
+	case "", "asc":
+		return "asc", nil
+	case "desc":
+		return "desc", nil
+	}
+	return "", errors.New("dbstorage: invalid order direction: " + order)
+}
+
+// checkOperator only lets through the operators in the lists above, not arbitrary SQL.
+func checkOperator(d Dialect, op string) error {
+	lop := strings.ToLower(strings.Join(strings.Fields(op), " "))
+	ops := append(append([]string{}, keywordOperators...), symbolOperators...)
+	if d.Placeholder(1) != "?" {
+		ops = append(ops, numberedOperators...)
+	}
+	for _, item := range ops {
+		if lop == item {
+			return nil
+		}
+	}
+	return errors.New("dbstorage: invalid operator: " + op)
+}
@@ -0,0 +1,236 @@
+package dbstorage
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+)
+
+// IDGenerator hands out application-assigned integer ids for a table. Tag the id field of a table that
+// uses one `dbsorm:"assigned"` so CreateTableStruct does not make it an identity column.
+type IDGenerator interface {
+	NextID(ctx context.Context, table string) (int64, error)
+}
+
+// StringIDGenerator hands out application-assigned string ids for a table.
+type StringIDGenerator interface {
+	NextStringID(ctx context.Context, table string) (string, error)
+}
+
+//
+//
+
+type tableAllocator struct {
+	db     Inner
+	mu     sync.Mutex
+	tables map[string]*tableCounter
+}
+
+type tableCounter struct {
+	mu   sync.Mutex
+	next int64 // 0 until seeded from the database
+}
+
+// NewTableAllocator returns an IDGenerator that seeds each table from QueryNextID once and then counts up in memory.
+// Each table has its own lock, so inserts into different tables do not wait on each other. Only safe when this
+// process is the only writer of the table.
+func NewTableAllocator(db Inner) IDGenerator {
+	return &tableAllocator{db: db, tables: map[string]*tableCounter{}}
+}
+
+func (a *tableAllocator) NextID(ctx context.Context, table string) (int64, error) {
+	a.mu.Lock()
+	c, ok := a.tables[table]
+	if !ok {
+		c = new(tableCounter)
+		a.tables[table] = c
+	}
+	a.mu.Unlock()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.next == 0 {
+		n, err := a.db.QueryNextIDContext(ctx, table)
+		if err != nil {
+			return 0, err
+		}
+		c.next = n
+	}
+	id := c.next
+	c.next++
+	return id, nil
+}
+
+//
+//
+
+type hiLoAllocator struct {
+	db        Inner
+	seqTable  string
+	blockSize int64
+	mu        sync.Mutex
+	blocks    map[string]*[2]int64 // next id, end of block
+}
+
+// NewHiLoAllocator returns an IDGenerator that reserves blocks of blockSize ids at a time from a sequence table
+// named seqTable, which is created if missing. Reservations use compare-and-swap updates, so any number of
+// processes may share the same sequence table.
+func NewHiLoAllocator(db Inner, seqTable string, blockSize int64) (IDGenerator, error) {
+	if blockSize < 1 {
+		return nil, errors.New("dbstorage: hilo: block size must be positive")
+	}
+	err := db.CreateTableE(seqTable, []string{"name", "varchar(191) primary key"}, [][]string{{"hi", "bigint"}})
+	if err != nil {
+		return nil, err
+	}
+	return &hiLoAllocator{db: db, seqTable: seqTable, blockSize: blockSize, blocks: map[string]*[2]int64{}}, nil
+}
+
+func (a *hiLoAllocator) NextID(ctx context.Context, table string) (int64, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	b, ok := a.blocks[table]
+	if !ok || b[0] == b[1] {
+		hi, err := a.reserve(ctx, table)
+		if err != nil {
+			return 0, err
+		}
+		b = &[2]int64{hi * a.blockSize, (hi + 1) * a.blockSize}
+		a.blocks[table] = b
+	}
+	id := b[0]
+	b[0]++
+	return id, nil
+}
+
+// reserve claims the next hi value for table.
+func (a *hiLoAllocator) reserve(ctx context.Context, table string) (int64, error) {
+	for i := 0; i < 10; i++ {
+		hi, err := a.currentHi(ctx, table)
+		if err != nil {
+			return 0, err
+		}
+		if hi == -1 {
+			// first block for this table, start past any ids already in use
+			next, err := a.db.QueryNextIDContext(ctx, table)
+			if err != nil {
+				return 0, err
+			}
+			hi = (next + a.blockSize - 1) / a.blockSize
+			if _, err := a.db.Build().Ins(a.seqTable, table, hi+1).ExecContext(ctx); err != nil {
+				// only a row that is there now means another process won the race to create it
+				if now, serr := a.currentHi(ctx, table); serr != nil || now == -1 {
+					return 0, err
+				}
+				continue
+			}
+			return hi, nil
+		}
+		res, err := a.db.Build().UpV(a.seqTable, "hi", hi+1).Wh("name", table).WhV("hi", hi).ExecContext(ctx)
+		if err != nil {
+			return 0, err
+		}
+		if n, _ := res.RowsAffected(); n == 1 {
+			return hi, nil
+		}
+	}
+	return 0, errors.New("dbstorage: hilo: could not reserve a block for " + table)
+}
+
+// currentHi is the next hi value stored for table, or -1 if it has no row yet.
+func (a *hiLoAllocator) currentHi(ctx context.Context, table string) (int64, error) {
+	rows, err := a.db.Build().Se("hi").Fr(a.seqTable).Wh("name", table).ExeContext(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+	hi := int64(-1)
+	if rows.Next() {
+		if err := rows.Scan(&hi); err != nil {
+			return 0, err
+		}
+	}
+	return hi, rows.Err()
+}
+
+//
+//
+
+// SnowflakeEpoch is the start of time for ids made by NewSnowflake, 2020-01-01 UTC.
+var SnowflakeEpoch = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+type snowflake struct {
+	mu   sync.Mutex
+	node int64
+	last int64 // milliseconds since SnowflakeEpoch
+	seq  int64
+}
+
+// NewSnowflake returns an IDGenerator that packs a 41-bit millisecond timestamp, a 10-bit node number, and a
+// 12-bit sequence into each id. Every process sharing a table must use a different node.
+func NewSnowflake(node int64) (IDGenerator, error) {
+	if node < 0 || node >= 1<<10 {
+		return nil, errors.New("dbstorage: snowflake: node must be between 0 and 1023")
+	}
+	return &snowflake{node: node}, nil
+}
+
+func (s *snowflake) NextID(ctx context.Context, table string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Since(SnowflakeEpoch).Milliseconds()
+	if now < s.last {
+		// the clock went backwards, keep counting from the last time we saw
+		now = s.last
+	}
+	if now == s.last {
+		s.seq = (s.seq + 1) & (1<<12 - 1)
+		if s.seq == 0 {
+			for now <= s.last {
+				time.Sleep(time.Millisecond)
+				now = time.Since(SnowflakeEpoch).Milliseconds()
+			}
+		}
+	} else {
+		s.seq = 0
+	}
+	s.last = now
+	return now<<22 | s.node<<12 | s.seq, nil
+}
+
+//
+//
+
+type uuidV7 struct{}
+
+// NewUUIDv7 returns a StringIDGenerator of time-ordered RFC 9562 version 7 UUIDs. Use it with UUIDPrimaryKey.
+func NewUUIDv7() StringIDGenerator {
+	return uuidV7{}
+}
+
+func (uuidV7) NextStringID(ctx context.Context, table string) (string, error) {
+	var u [16]byte
+	if _, err := rand.Read(u[6:]); err != nil {
+		return "", err
+	}
+	ms := time.Now().UnixMilli()
+	for i := 0; i < 6; i++ {
+		u[i] = byte(ms >> (40 - 8*i))
+	}
+	u[6] = u[6]&0x0f | 0x70
+	u[8] = u[8]&0x3f | 0x80
+	b := make([]byte, 36)
+	hex.Encode(b[0:8], u[0:4])
+	b[8] = '-'
+	hex.Encode(b[9:13], u[4:6])
+	b[13] = '-'
+	hex.Encode(b[14:18], u[6:8])
+	b[18] = '-'
+	hex.Encode(b[19:23], u[8:10])
+	b[23] = '-'
+	hex.Encode(b[24:], u[10:])
+	return string(b), nil
+}
@@ -2,16 +2,12 @@ package dbstorage
 
 import (
 	"database/sql"
-	"database/sql/driver"
 	"errors"
 	"fmt"
 	"reflect"
-	"strconv"
 	"strings"
 	"time"
 
-	"github.com/nektro/go-util/arrays/stringsu"
-	"github.com/nektro/go-util/util"
 	"github.com/nektro/go-util/vflag"
 
 	_ "github.com/go-sql-driver/mysql"
@@ -28,10 +24,6 @@ var (
 	}
 )
 
-type mysqlDB struct {
-	db *sql.DB
-}
-
 // ConnectMysql does
 func ConnectMysql() (Database, error) {
 	dsn := fmt.Sprintf("%s:%s@tcp(%s)/%s", *flagsMysql[1], *flagsMysql[2], *flagsMysql[0], *flagsMysql[3])
@@ -42,34 +34,48 @@ func ConnectMysql() (Database, error) {
 	db.SetMaxOpenConns(1)
 	db.SetMaxIdleConns(0)
 	db.SetConnMaxLifetime(time.Second)
-	return &Outer{&mysqlDB{db}}, db.Ping()
+	return &Outer{&DbProxy{db: db, dialect: mysqlDialect{}}}, db.Ping()
 }
 
-func (db *mysqlDB) Ping() error {
-	return db.db.Ping()
+//
+//
+
+type mysqlDialect struct{}
+
+func (mysqlDialect) DriverName() string {
+	return "mysql"
 }
 
-func (db *mysqlDB) Close() error {
-	return db.db.Close()
+func (mysqlDialect) TagName() string {
+	return "mysql"
 }
 
-func (db *mysqlDB) DB() *sql.DB {
-	return db.db
+func (mysqlDialect) Placeholder(n int) string {
+	return "?"
 }
 
-func (db *mysqlDB) DriverName() string {
-	return "mysql"
+// BackslashEscapes is the default unless NO_BACKSLASH_ESCAPES is in sql_mode.
+func (mysqlDialect) BackslashEscapes() bool {
+	return true
 }
 
-func (db *mysqlDB) TagName() string {
-	return "mysql"
+func (mysqlDialect) QuoteIdent(name string) string {
+	return "`" + strings.ReplaceAll(name, "`", "``") + "`"
 }
 
-func (db *mysqlDB) IntPrimaryKey() string {
+func (mysqlDialect) IntPrimaryKey() string {
 	return "BIGINT NOT NULL PRIMARY KEY"
 }
 
-func (db *mysqlDB) TypeForType(t reflect.Type) string {
+func (mysqlDialect) AutoIncrementPrimaryKey() string {
+	return "BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY"
+}
+
+func (mysqlDialect) UUIDPrimaryKey() string {
+	return "CHAR(36) NOT NULL PRIMARY KEY"
+}
+
+func (d mysqlDialect) TypeForType(t reflect.Type) string {
 	switch t.Name() {
 	case "string":
 		return "text"
@@ -86,234 +92,63 @@ func (db *mysqlDB) TypeForType(t reflect.Type) string {
 	case "float64":
 		return "DOUBLE"
 	}
-	dv, ok := reflect.New(t).Interface().(driver.Valuer)
-	if ok {
-		v, _ := dv.Value()
-		return db.TypeForType(reflect.TypeOf(v))
-	}
-	return ""
+	return typeForValuer(d, t)
 }
 
-func (db *mysqlDB) CreateTable(name string, pk []string, columns [][]string) {
-	if !db.DoesTableExist(name) {
-		db.QueryPrepared(true, F("CREATE TABLE %s(%s %s)", name, pk[0], pk[1]))
-		util.Log(F("Created table '%s'", name))
-	}
-	pti := db.QueryColumnList(name)
-	for _, col := range columns {
-		if !stringsu.Contains(pti, col[0]) {
-			db.QueryPrepared(true, F("ALTER TABLE %s ADD %s %s", name, col[0], col[1]))
-			util.Log(F("Added column '%s.%s'", name, col[0]))
-		}
-	}
+func (d mysqlDialect) CreateTable(name string, pk string, pkType string) string {
+	return F("CREATE TABLE %s(%s %s)", d.QuoteIdent(name), d.QuoteIdent(pk), pkType)
 }
 
-func (db *mysqlDB) DoesTableExist(table string) bool {
-	q := db.QueryPrepared(false, "SHOW TABLES LIKE '"+table+"'")
-	defer q.Close()
-	return q.Next()
+func (d mysqlDialect) AddColumn(table string, col string, typ string) string {
+	return F("ALTER TABLE %s ADD %s %s", d.QuoteIdent(table), d.QuoteIdent(col), typ)
 }
 
-func (db *mysqlDB) QueryColumnList(table string) []string {
-	var result []string
-	q := db.QueryPrepared(false, "SHOW COLUMNS FROM "+table)
-	defer q.Close()
-	for q.Next() {
-		var name string
-		var typ string
-		var nul bool
-		var key string
-		var def string
-		var extra string
-		q.Scan(&name, &typ, &nul, &key, &def, &extra)
-		result = append(result, name)
-	}
-	return result
+func (d mysqlDialect) DropTable(name string) string {
+	return "DROP TABLE IF EXISTS " + d.QuoteIdent(name)
 }
 
-func (db *mysqlDB) QueryNextID(table string) int64 {
-	result := int64(0)
-	rows := db.QueryPrepared(false, F("SELECT id FROM %s ORDER BY id DESC LIMIT 1", table))
-	for rows.Next() {
-		rows.Scan(&result)
-	}
-	rows.Close()
-	return result + 1
+func (mysqlDialect) TableExists(table string) (string, []interface{}) {
+	return "SELECT table_name FROM information_schema.tables WHERE table_schema = DATABASE() AND table_name = ?", []interface{}{table}
 }
 
-func (db *mysqlDB) QueryPrepared(modify bool, q string, args ...interface{}) *sql.Rows {
-	stmt, err := db.db.Prepare(q)
-	if err != nil {
-		return nil
-	}
-	if modify {
-		stmt.Exec(args...)
-		return nil
-	}
-	rows, _ := stmt.Query(args...)
-	if err != nil {
-		return nil
-	}
-	return rows
+func (mysqlDialect) ColumnList(table string) (string, []interface{}) {
+	return "SELECT column_name FROM information_schema.columns WHERE table_schema = DATABASE() AND table_name = ? ORDER BY ordinal_position", []interface{}{table}
 }
 
-func (db *mysqlDB) DropTable(name string) {
-	db.QueryPrepared(true, "DROP TABLE IF EXISTS "+name)
+func (mysqlDialect) Savepoint(name string) (string, string, string) {
+	return "SAVEPOINT " + name, "RELEASE SAVEPOINT " + name, "ROLLBACK TO SAVEPOINT " + name
 }
 
-func (db *mysqlDB) QueryRowCount(table string) int64 {
-	rows := db.QueryPrepared(false, "SELECT COUNT(*) FROM "+table)
-	if rows == nil {
-		return -1
-	}
-	defer rows.Close()
-	c := int64(0)
-	rows.Next()
-	rows.Scan(&c)
-	return c
+func (mysqlDialect) MaxParams() int {
+	return 65535
 }
 
-//
-//
-
-type mysqlQB struct {
-	d *mysqlDB       // db
-	q string         // query string
-	v []driver.Value // values
-	m bool           // modify
-	w [][4]string    // where's
-	o [][2]string    // order's
-	l int64          // limit
-	f int64          // offset
+func (mysqlDialect) LastInsertID() bool {
+	return true
 }
 
-func (db *mysqlDB) Build() QueryBuilder {
-	qb := new(mysqlQB)
-	qb.d = db
-	return qb
+func (mysqlDialect) Returning() bool {
+	return false
 }
 
-func (qb *mysqlQB) Se(cols string) QueryBuilder {
-	qb.m = false
-	qb.q = qb.q + "SELECT " + cols
-	return qb
-}
-
-func (qb *mysqlQB) Fr(table string) QueryBuilder {
-	qb.q = qb.q + " FROM " + table
-	return qb
-}
-
-func (qb *mysqlQB) WR(col string, op string, value string, raw bool, ags ...interface{}) QueryBuilder {
-	qb.w = append(qb.w, [4]string{col, op, value, strconv.FormatBool(raw)})
-	for _, item := range ags {
-		o, _ := driver.DefaultParameterConverter.ConvertValue(item)
-		qb.v = append(qb.v, o)
+// Upsert uses the values of the key that conflicted, so conflict is not needed.
+func (mysqlDialect) Upsert(conflict []string, update []string) (string, string) {
+	if len(update) == 0 {
+		return "insert ignore into", ""
 	}
-	return qb
-}
-
-func (qb *mysqlQB) Wr(col string, op string, value string) QueryBuilder {
-	qb.WR(col, op, value, false)
-	return qb
-}
-
-func (qb *mysqlQB) Wh(col string, value string) QueryBuilder {
-	qb.Wr(col, "=", value)
-	return qb
-}
-
-func (qb *mysqlQB) Or(col string, order string) QueryBuilder {
-	qb.o = append(qb.o, [2]string{col, order})
-	return qb
-}
-
-func (qb *mysqlQB) Lm(limit int64) QueryBuilder {
-	qb.l = limit
-	return qb
-}
-
-func (qb *mysqlQB) Of(offset int64) QueryBuilder {
-	qb.f = offset
-	return qb
-}
-
-func (qb *mysqlQB) Exe() *sql.Rows {
-	vals := []string{}
-	for _, item := range qb.v {
-		if b, ok := item.(bool); ok {
-			vals = append(vals, strconv.Itoa(util.Btoi(b)))
-			continue
-		}
-		vals = append(vals, fmt.Sprintf("%v", item))
-	}
-	for i, item := range qb.w {
-		if item[3] == "false" {
-			if i == 0 {
-				qb.q += " WHERE " + item[0] + " " + item[1] + " ?"
-			} else {
-				qb.q += " AND " + item[0] + " " + item[1] + " ?"
-			}
-			vals = append(vals, item[2])
-		} else {
-			if i == 0 {
-				qb.q += " WHERE " + item[0] + " " + item[1] + " " + item[2]
-			} else {
-				qb.q += " AND " + item[0] + " " + item[1] + " " + item[2]
-			}
-		}
-	}
-	for i, item := range qb.o {
-		if i == 0 {
-			qb.q += " ORDER BY " + item[0] + " " + item[1]
-		} else {
-			qb.q += ", " + item[0] + " " + item[1]
-		}
-	}
-	if qb.l > 0 {
-		qb.q += " LIMIT " + strconv.FormatInt(qb.l, 10)
-
-		if qb.f > 0 {
-			qb.q += " OFFSET " + strconv.FormatInt(qb.f, 10)
-		}
-	}
-	iva := make([]interface{}, len(vals))
-	for i, v := range vals {
-		iva[i] = v
+	set := []string{}
+	for _, item := range update {
+		set = append(set, item+" = values("+item+")")
 	}
-	return qb.d.QueryPrepared(qb.m, qb.q, iva...)
+	return "insert into", " on duplicate key update " + strings.Join(set, ", ")
 }
 
-func (qb *mysqlQB) Up(table string, col string, value string) QueryBuilder {
-	qb.m = true
-	qb.q = qb.q + "UPDATE " + table + " SET " + col + " = ?"
-	qb.v = append(qb.v, value)
-	return qb
-}
-
-func (qb *mysqlQB) Ins(table string, values ...interface{}) Executable {
-	qb.m = true
-	qb.q = qb.q + "INSERT INTO " + table + " VALUES (" + strings.Join(strings.Split(strings.Repeat("?", len(values)), ""), ",") + ")"
-	for _, item := range values {
-		o, _ := driver.DefaultParameterConverter.ConvertValue(item)
-		qb.v = append(qb.v, o)
-	}
-	return qb
-}
-
-func (qb *mysqlQB) InsI(table string, strct interface{}) Executable {
-	v := reflect.ValueOf(strct).Elem()
-	t := v.Type()
-	atrs := []interface{}{}
-	for i := 0; i < t.NumField(); i++ {
-		sv := v.Field(i).Interface()
-		atrs = append(atrs, sv)
-	}
-	return qb.Ins(table, atrs...)
+// RowValues is off since MySQL before 8.0.32 does not use indexes for row comparisons.
+func (mysqlDialect) RowValues() bool {
+	return false
 }
 
-func (qb *mysqlQB) Del(table string) QueryBuilder {
-	qb.m = true
-	qb.q = "DELETE FROM " + table
-	return qb
+// ILike lowercases both sides since whether like ignores case depends on the collation of col.
+func (mysqlDialect) ILike(col string, value string, escape bool) string {
+	return "lower(" + col + ") like lower(" + value + ")" + likeEscape(escape)
 }
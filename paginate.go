@@ -0,0 +1,248 @@
+package dbstorage
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	. "github.com/nektro/go-util/alias"
+)
+
+// Page is one page of rows from Paginate.
+type Page[T any] struct {
+	Items []T
+	// Next is the cursor of the page after this one, empty if this is the last.
+	Next string
+	// Prev is the cursor of the page before this one, empty if this is the first.
+	Prev string
+}
+
+// cursor is what Paginate encodes into Page.Next and Page.Prev.
+type cursor struct {
+	Values []cursorValue `json:"v"`
+	Back   bool          `json:"b,omitempty"`
+}
+
+// cursorValue keeps the type of a sort key through JSON, so it is bound the same way it was written.
+type cursorValue struct {
+	Kind  string `json:"k"`
+	Value string `json:"v,omitempty"`
+}
+
+// Paginate returns the page of pageSize rows of qb after or before cursor, or the first page if cursor is empty.
+// orderCols are given like Or, as "col" or "col desc", and follow any order qb already has. Together with that
+// order they must be unique and not null, such as ending in the id, and each must name a json tagged field of T.
+// A limit or offset on qb is ignored. qb is not changed, so it can be paged again with another cursor.
+func Paginate[T any](qb QueryBuilder, orderCols []string, cursor string, pageSize int64) (Page[T], error) {
+	return PaginateContext[T](context.Background(), qb, orderCols, cursor, pageSize)
+}
+
+func PaginateContext[T any](ctx context.Context, qb QueryBuilder, orderCols []string, cursor string, pageSize int64) (Page[T], error) {
+	page := Page[T]{}
+	if pageSize <= 0 || len(orderCols) == 0 {
+		return page, E("dbstorage: paginate needs order columns and a page size")
+	}
+	b, ok := qb.(*queryBuilder)
+	if !ok {
+		return page, E(F("dbstorage: paginate needs a QueryBuilder from Build, got %T", qb))
+	}
+	// the order qb already has comes first in the sort key, and is replaced below by one that can go backwards
+	q := *b
+	q.w = append([]Cond{}, b.w...)
+	q.o = nil
+	// the cursor says where the page starts, and Lm below sets its size
+	q.f = 0
+	prior := []string{}
+	for _, item := range b.o {
+		prior = append(prior, item[0]+" "+item[1])
+	}
+	cols := []string{}
+	desc := []bool{}
+	for _, item := range append(prior, orderCols...) {
+		f := strings.Fields(item)
+		if len(f) == 0 || len(f) > 2 {
+			return page, E("dbstorage: invalid order column: " + item)
+		}
+		dir, err := orderDirection(strings.Join(f[1:], ""))
+		if err != nil {
+			return page, err
+		}
+		cols = append(cols, f[0])
+		desc = append(desc, dir == "desc")
+	}
+	c, err := decodeCursor(cursor, len(cols))
+	if err != nil {
+		return page, err
+	}
+	if c != nil {
+		q.Where(&seekCond{cols, desc, c.Values, c.Back})
+	}
+	for i, item := range cols {
+		if desc[i] != (c != nil && c.Back) {
+			q.Or(item, "desc")
+		} else {
+			q.Or(item, "asc")
+		}
+	}
+	items, err := AllContext[T](ctx, q.Lm(pageSize+1))
+	if err != nil {
+		return page, err
+	}
+	more := int64(len(items)) > pageSize
+	if more {
+		items = items[:pageSize]
+	}
+	if c != nil && c.Back {
+		for i, j := 0, len(items)-1; i < j; i, j = i+1, j-1 {
+			items[i], items[j] = items[j], items[i]
+		}
+	}
+	page.Items = items
+	if len(items) == 0 {
+		return page, nil
+	}
+	if more || (c != nil && c.Back) {
+		if page.Next, err = encodeCursor(items[len(items)-1], cols, false); err != nil {
+			return page, err
+		}
+	}
+	if c != nil && (!c.Back || more) {
+		if page.Prev, err = encodeCursor(items[0], cols, true); err != nil {
+			return page, err
+		}
+	}
+	return page, nil
+}
+
+func encodeCursor(item interface{}, cols []string, back bool) (string, error) {
+	v := reflect.Indirect(reflect.ValueOf(item))
+	if v.Kind() != reflect.Struct {
+		return "", E(F("dbstorage: paginate needs rows that are structs, got %T", item))
+	}
+	fields := structFields(v.Type())
+	c := cursor{Back: back}
+	for _, col := range cols {
+		index, ok := fields[strings.ToLower(col[strings.LastIndex(col, ".")+1:])]
+		if !ok {
+			return "", E(F("dbstorage: %T has no field for order column %s", item, col))
+		}
+		o, err := bindValue(v.FieldByIndex(index).Interface())
+		if err != nil {
+			return "", err
+		}
+		switch o := o.(type) {
+		case int64:
+			c.Values = append(c.Values, cursorValue{"i", strconv.FormatInt(o, 10)})
+		case float64:
+			c.Values = append(c.Values, cursorValue{"f", strconv.FormatFloat(o, 'g', -1, 64)})
+		case string:
+			c.Values = append(c.Values, cursorValue{"s", o})
+		case []byte:
+			c.Values = append(c.Values, cursorValue{"b", base64.RawURLEncoding.EncodeToString(o)})
+		case time.Time:
+			c.Values = append(c.Values, cursorValue{"t", o.Format(time.RFC3339Nano)})
+		default:
+			return "", E(F("dbstorage: order column %s can not be null", col))
+		}
+	}
+	b, err := json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func decodeCursor(s string, n int) (*cursor, error) {
+	if len(s) == 0 {
+		return nil, nil
+	}
+	invalid := E("dbstorage: invalid cursor")
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, invalid
+	}
+	c := &cursor{}
+	if json.Unmarshal(b, c) != nil || len(c.Values) != n {
+		return nil, invalid
+	}
+	return c, nil
+}
+
+// value is the sort key as it was before encoding.
+func (v cursorValue) value() (interface{}, error) {
+	switch v.Kind {
+	case "i":
+		return strconv.ParseInt(v.Value, 10, 64)
+	case "f":
+		return strconv.ParseFloat(v.Value, 64)
+	case "s":
+		return v.Value, nil
+	case "b":
+		return base64.RawURLEncoding.DecodeString(v.Value)
+	case "t":
+		return time.Parse(time.RFC3339Nano, v.Value)
+	}
+	return nil, E("dbstorage: invalid cursor")
+}
+
+// seekCond matches the rows after, or before when back is set, the sort key values in the order of cols.
+type seekCond struct {
+	cols   []string
+	desc   []bool
+	values []cursorValue
+	back   bool
+}
+
+func (c *seekCond) render(r *renderer) {
+	values := []interface{}{}
+	for _, item := range c.values {
+		v, err := item.value()
+		if err != nil && r.err == nil {
+			r.err = err
+		}
+		values = append(values, v)
+	}
+	// after a column that sorts descending is less than, before it is greater than
+	op := func(i int) string {
+		if c.desc[i] != c.back {
+			return "<"
+		}
+		return ">"
+	}
+	same := true
+	for i := range c.desc {
+		same = same && c.desc[i] == c.desc[0]
+	}
+	if same && r.d.RowValues() {
+		r.raw("(")
+		for i, item := range c.cols {
+			if i > 0 {
+				r.raw(", ")
+			}
+			r.expr(item)
+		}
+		r.raw(") " + op(0) + " (")
+		for i, item := range values {
+			if i > 0 {
+				r.raw(", ")
+			}
+			r.bind(item)
+		}
+		r.raw(")")
+		return
+	}
+	or := []Cond{}
+	for i := range c.cols {
+		and := []Cond{}
+		for j := 0; j < i; j++ {
+			and = append(and, Eq(c.cols[j], values[j]))
+		}
+		and = append(and, C(c.cols[i], op(i), values[i]))
+		or = append(or, AllOf(and...))
+	}
+	AnyOf(or...).render(r)
+}
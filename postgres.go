@@ -1,21 +1,18 @@
 package dbstorage
 
 import (
+	"context"
 	"database/sql"
-	"database/sql/driver"
 	"errors"
-	"fmt"
 	"net/url"
 	"reflect"
 	"strconv"
 	"strings"
 	"time"
 
-	"github.com/nektro/go-util/arrays/stringsu"
-	"github.com/nektro/go-util/util"
 	"github.com/nektro/go-util/vflag"
 
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 	. "github.com/nektro/go-util/alias"
 )
 
@@ -30,10 +27,6 @@ var (
 	}
 )
 
-type postgresDB struct {
-	db *sql.DB
-}
-
 // ConnectPostgres does
 func ConnectPostgres() (Database, error) {
 	op := url.Values{}
@@ -50,34 +43,49 @@ func ConnectPostgres() (Database, error) {
 	db.SetMaxOpenConns(1)
 	db.SetMaxIdleConns(0)
 	db.SetConnMaxLifetime(time.Second)
-	return &Outer{&postgresDB{db}}, db.Ping()
+	return &Outer{&DbProxy{db: db, dialect: postgresDialect{}}}, db.Ping()
 }
 
-func (db *postgresDB) Ping() error {
-	return db.db.Ping()
+//
+//
+
+type postgresDialect struct{}
+
+func (postgresDialect) DriverName() string {
+	return "postgres"
 }
 
-func (db *postgresDB) Close() error {
-	return db.db.Close()
+func (postgresDialect) TagName() string {
+	return "postgres"
 }
 
-func (db *postgresDB) DB() *sql.DB {
-	return db.db
+func (postgresDialect) Placeholder(n int) string {
+	return "$" + strconv.Itoa(n)
 }
 
-func (db *postgresDB) DriverName() string {
-	return "postgres"
+func (postgresDialect) BackslashEscapes() bool {
+	return false
 }
 
-func (db *postgresDB) TagName() string {
-	return "postgres"
+// QuoteIdent lowercases name first, so that tables and columns made before names were quoted still match.
+func (postgresDialect) QuoteIdent(name string) string {
+	return `"` + strings.ReplaceAll(strings.ToLower(name), `"`, `""`) + `"`
 }
 
-func (db *postgresDB) IntPrimaryKey() string {
+func (postgresDialect) IntPrimaryKey() string {
 	return "BIGINT PRIMARY KEY NOT NULL"
 }
 
-func (db *postgresDB) TypeForType(t reflect.Type) string {
+// AutoIncrementPrimaryKey is an identity column, whose sequence does not advance past ids inserted explicitly.
+func (postgresDialect) AutoIncrementPrimaryKey() string {
+	return "BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY"
+}
+
+func (postgresDialect) UUIDPrimaryKey() string {
+	return "UUID PRIMARY KEY"
+}
+
+func (d postgresDialect) TypeForType(t reflect.Type) string {
 	switch t.Name() {
 	case "string":
 		return "text"
@@ -92,240 +100,93 @@ func (db *postgresDB) TypeForType(t reflect.Type) string {
 	case "float64":
 		return "double precision"
 	}
-	dv, ok := reflect.New(t).Interface().(driver.Valuer)
-	if ok {
-		v, _ := dv.Value()
-		return db.TypeForType(reflect.TypeOf(v))
-	}
-	return ""
+	return typeForValuer(d, t)
 }
 
-func (db *postgresDB) CreateTable(name string, pk []string, columns [][]string) {
-	if !db.DoesTableExist(name) {
-		db.QueryPrepared(true, F("CREATE TABLE %s(%s %s)", name, pk[0], pk[1]))
-		util.Log(F("Created table '%s'", name))
-	}
-	pti := db.QueryColumnList(name)
-	for _, col := range columns {
-		if !stringsu.Contains(pti, col[0]) {
-			db.QueryPrepared(true, F("ALTER TABLE %s ADD COLUMN %s %s", name, col[0], col[1]))
-			util.Log(F("Added column '%s.%s'", name, col[0]))
-		}
-	}
+func (d postgresDialect) CreateTable(name string, pk string, pkType string) string {
+	return F("CREATE TABLE %s(%s %s)", d.QuoteIdent(name), d.QuoteIdent(pk), pkType)
 }
 
-func (db *postgresDB) DoesTableExist(table string) bool {
-	table = strings.ToLower(table)
-	// https://www.postgresql.org/docs/9.5/infoschema-tables.html
-	q := db.QueryPrepared(false, F("SELECT * FROM information_schema.tables WHERE table_name = '%s'", table))
-	if q == nil {
-		return false
-	}
-	defer q.Close()
-	return q.Next()
+func (d postgresDialect) AddColumn(table string, col string, typ string) string {
+	return F("ALTER TABLE %s ADD COLUMN %s %s", d.QuoteIdent(table), d.QuoteIdent(col), typ)
 }
 
-func (db *postgresDB) QueryColumnList(table string) []string {
-	table = strings.ToLower(table)
-	var result []string
-	// https://www.postgresql.org/docs/9.5/infoschema-columns.html
-	rows := db.QueryPrepared(false, F("SELECT column_name FROM information_schema.columns WHERE table_name = '%s'", table))
-	defer rows.Close()
-	for rows.Next() {
-		var v string
-		rows.Scan(&v)
-		result = append(result, v)
-	}
-	return result
+func (d postgresDialect) DropTable(name string) string {
+	return "DROP TABLE IF EXISTS " + d.QuoteIdent(name)
 }
 
-func (db *postgresDB) QueryNextID(table string) int64 {
-	result := int64(0)
-	rows := db.QueryPrepared(false, F("SELECT id FROM %s ORDER BY id DESC LIMIT 1", table))
-	defer rows.Close()
-	for rows.Next() {
-		rows.Scan(&result)
-	}
-	return result + 1
+func (postgresDialect) TableExists(table string) (string, []interface{}) {
+	// https://www.postgresql.org/docs/9.5/infoschema-tables.html
+	return "SELECT * FROM information_schema.tables WHERE table_name = $1", []interface{}{strings.ToLower(table)}
 }
 
-func (db *postgresDB) QueryPrepared(modify bool, q string, args ...interface{}) *sql.Rows {
-	stmt, err := db.db.Prepare(q)
-	if err != nil {
-		return nil
-	}
-	if modify {
-		stmt.Exec(args...)
-		return nil
-	}
-	rows, _ := stmt.Query(args...)
-	if err != nil {
-		return nil
-	}
-	return rows
+func (postgresDialect) ColumnList(table string) (string, []interface{}) {
+	// https://www.postgresql.org/docs/9.5/infoschema-columns.html
+	return "SELECT column_name FROM information_schema.columns WHERE table_name = $1", []interface{}{strings.ToLower(table)}
 }
 
-func (db *postgresDB) DropTable(name string) {
-	db.QueryPrepared(true, "DROP TABLE IF EXISTS "+name)
+func (postgresDialect) Savepoint(name string) (string, string, string) {
+	return "SAVEPOINT " + name, "RELEASE SAVEPOINT " + name, "ROLLBACK TO SAVEPOINT " + name
 }
 
-func (db *postgresDB) QueryRowCount(table string) int64 {
-	rows := db.QueryPrepared(false, "SELECT COUNT(*) FROM "+table)
-	if rows == nil {
-		return -1
-	}
-	defer rows.Close()
-	c := int64(0)
-	rows.Next()
-	rows.Scan(&c)
-	return c
+func (postgresDialect) MaxParams() int {
+	return 65535
 }
 
-//
-//
-
-type postgresQB struct {
-	d *postgresDB    // db
-	q string         // query string
-	v []driver.Value // values
-	m bool           // modify
-	w [][4]string    // where's
-	o [][2]string    // order's
-	l int64          // limit
-	f int64          // offset
-}
-
-func (db *postgresDB) Build() QueryBuilder {
-	qb := new(postgresQB)
-	qb.d = db
-	return qb
+func (postgresDialect) LastInsertID() bool {
+	return false
 }
 
-func (qb *postgresQB) Se(cols string) QueryBuilder {
-	qb.m = false
-	qb.q = qb.q + "SELECT " + cols
-	return qb
+func (postgresDialect) Returning() bool {
+	return true
 }
 
-func (qb *postgresQB) Fr(table string) QueryBuilder {
-	qb.q = qb.q + " FROM " + table
-	return qb
+func (postgresDialect) Upsert(conflict []string, update []string) (string, string) {
+	return "insert into", onConflict(conflict, update)
 }
 
-func (qb *postgresQB) WR(col string, op string, value string, raw bool, ags ...interface{}) QueryBuilder {
-	qb.w = append(qb.w, [4]string{col, op, value, strconv.FormatBool(raw)})
-	for _, item := range ags {
-		o, _ := driver.DefaultParameterConverter.ConvertValue(item)
-		qb.v = append(qb.v, o)
+// CopyIn loads rows with COPY FROM STDIN. The names are lowercased to match QuoteIdent.
+func (d postgresDialect) CopyIn(ctx context.Context, tx *sql.Tx, table string, cols []string, rows [][]interface{}) error {
+	if _, err := quoteName(d, table); err != nil {
+		return err
 	}
-	return qb
-}
-
-func (qb *postgresQB) Wr(col string, op string, value string) QueryBuilder {
-	qb.WR(col, op, value, false)
-	return qb
-}
-
-func (qb *postgresQB) Wh(col string, value string) QueryBuilder {
-	qb.Wr(col, "=", value)
-	return qb
-}
-
-func (qb *postgresQB) Or(col string, order string) QueryBuilder {
-	qb.o = append(qb.o, [2]string{col, order})
-	return qb
-}
-
-func (qb *postgresQB) Lm(limit int64) QueryBuilder {
-	qb.l = limit
-	return qb
-}
-
-func (qb *postgresQB) Of(offset int64) QueryBuilder {
-	qb.f = offset
-	return qb
-}
-
-func (qb *postgresQB) Exe() *sql.Rows {
-	vals := []string{}
-	for _, item := range qb.v {
-		if b, ok := item.(bool); ok {
-			vals = append(vals, strconv.Itoa(util.Btoi(b)))
-			continue
+	names := []string{}
+	for _, item := range cols {
+		if _, err := quoteName(d, item); err != nil {
+			return err
 		}
-		vals = append(vals, fmt.Sprintf("%v", item))
+		names = append(names, strings.ToLower(item))
 	}
-	for i, item := range qb.w {
-		if item[3] == "false" {
-			if i == 0 {
-				qb.q += " WHERE " + item[0] + " " + item[1] + " ?"
-			} else {
-				qb.q += " AND " + item[0] + " " + item[1] + " ?"
-			}
-			vals = append(vals, item[2])
-		} else {
-			if i == 0 {
-				qb.q += " WHERE " + item[0] + " " + item[1] + " " + item[2]
-			} else {
-				qb.q += " AND " + item[0] + " " + item[1] + " " + item[2]
-			}
-		}
+	q := pq.CopyIn(strings.ToLower(table), names...)
+	if i := strings.Index(table, "."); i >= 0 {
+		q = pq.CopyInSchema(strings.ToLower(table[:i]), strings.ToLower(table[i+1:]), names...)
 	}
-	for i, item := range qb.o {
-		if i == 0 {
-			qb.q += " ORDER BY " + item[0] + " " + item[1]
-		} else {
-			qb.q += ", " + item[0] + " " + item[1]
+	stmt, err := tx.PrepareContext(ctx, q)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, item := range rows {
+		args := []interface{}{}
+		for _, v := range item {
+			o, err := bindValue(v)
+			if err != nil {
+				return err
+			}
+			args = append(args, o)
 		}
-	}
-	if qb.l > 0 {
-		qb.q += " LIMIT " + strconv.FormatInt(qb.l, 10)
-
-		if qb.f > 0 {
-			qb.q += " OFFSET " + strconv.FormatInt(qb.f, 10)
+		if _, err := stmt.ExecContext(ctx, args...); err != nil {
+			return err
 		}
 	}
-	iva := make([]interface{}, len(vals))
-	for i, v := range vals {
-		iva[i] = v
-	}
-	qcnt := strings.Count(qb.q, "?")
-	for i := 1; i <= qcnt; i++ {
-		qb.q = strings.Replace(qb.q, "?", "$"+strconv.Itoa(i), 1)
-	}
-	return qb.d.QueryPrepared(qb.m, qb.q, iva...)
-}
-
-func (qb *postgresQB) Up(table string, col string, value string) QueryBuilder {
-	qb.m = true
-	qb.q = qb.q + "UPDATE " + table + " SET " + col + " = ?"
-	qb.v = append(qb.v, value)
-	return qb
+	_, err = stmt.ExecContext(ctx)
+	return err
 }
 
-func (qb *postgresQB) Ins(table string, values ...interface{}) Executable {
-	qb.m = true
-	qb.q = qb.q + "INSERT INTO " + table + " VALUES (" + strings.Join(strings.Split(strings.Repeat("?", len(values)), ""), ",") + ")"
-	for _, item := range values {
-		o, _ := driver.DefaultParameterConverter.ConvertValue(item)
-		qb.v = append(qb.v, o)
-	}
-	return qb
-}
-
-func (qb *postgresQB) InsI(table string, strct interface{}) Executable {
-	v := reflect.ValueOf(strct).Elem()
-	t := v.Type()
-	atrs := []interface{}{}
-	for i := 0; i < t.NumField(); i++ {
-		sv := v.Field(i).Interface()
-		atrs = append(atrs, sv)
-	}
-	return qb.Ins(table, atrs...)
+func (postgresDialect) RowValues() bool {
+	return true
 }
 
-func (qb *postgresQB) Del(table string) QueryBuilder {
-	qb.m = true
-	qb.q = "DELETE FROM " + table
-	return qb
+func (postgresDialect) ILike(col string, value string, escape bool) string {
+	return col + " ilike " + value + likeEscape(escape)
 }
@@ -0,0 +1,266 @@
+package dbstorage
+
+import (
+	"context"
+	"database/sql"
+	"reflect"
+	"strings"
+
+	"github.com/nektro/go-util/util"
+
+	. "github.com/nektro/go-util/alias"
+)
+
+// DbProxy is the Inner shared by every backend, the SQL it generates comes from its Dialect.
+type DbProxy struct {
+	db      *sql.DB
+	tx      *sql.Tx
+	dialect Dialect
+}
+
+func (db *DbProxy) Ping() error {
+	return db.db.Ping()
+}
+
+func (db *DbProxy) PingContext(ctx context.Context) error {
+	return db.db.PingContext(ctx)
+}
+
+func (db *DbProxy) Close() error {
+	return db.db.Close()
+}
+
+func (db *DbProxy) DB() *sql.DB {
+	return db.db
+}
+
+func (db *DbProxy) Dialect() Dialect {
+	return db.dialect
+}
+
+func (db *DbProxy) conn() preparer {
+	if db.tx != nil {
+		return db.tx
+	}
+	return db.db
+}
+
+func (db *DbProxy) Begin() (Tx, error) {
+	return db.BeginTx(context.Background(), nil)
+}
+
+func (db *DbProxy) BeginTx(ctx context.Context, opts *sql.TxOptions) (Tx, error) {
+	tx, err := db.db.BeginTx(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	return newTxOuter(&DbProxy{db.db, tx, db.dialect}, tx), nil
+}
+
+func (db *DbProxy) DriverName() string {
+	return db.dialect.DriverName()
+}
+
+func (db *DbProxy) TagName() string {
+	return db.dialect.TagName()
+}
+
+func (db *DbProxy) IntPrimaryKey() string {
+	return db.dialect.IntPrimaryKey()
+}
+
+func (db *DbProxy) AutoIncrementPrimaryKey() string {
+	return db.dialect.AutoIncrementPrimaryKey()
+}
+
+func (db *DbProxy) UUIDPrimaryKey() string {
+	return db.dialect.UUIDPrimaryKey()
+}
+
+func (db *DbProxy) TypeForType(t reflect.Type) string {
+	return db.dialect.TypeForType(t)
+}
+
+func (db *DbProxy) CreateTable(name string, pk []string, columns [][]string) {
+	db.CreateTableE(name, pk, columns)
+}
+
+// CreateTableE is CreateTable but stops and returns the first error encountered.
+func (db *DbProxy) CreateTableE(name string, pk []string, columns [][]string) error {
+	return db.CreateTableContext(context.Background(), name, pk, columns)
+}
+
+func (db *DbProxy) CreateTableContext(ctx context.Context, name string, pk []string, columns [][]string) error {
+	exists, err := db.DoesTableExistContext(ctx, name)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		if _, err := db.ExecPreparedContext(ctx, db.dialect.CreateTable(name, pk[0], pk[1])); err != nil {
+			return err
+		}
+		util.Log(F("Created table '%s'", name))
+	}
+	pti, err := db.QueryColumnListContext(ctx, name)
+	if err != nil {
+		return err
+	}
+	for _, col := range columns {
+		if !containsFold(pti, col[0]) {
+			if _, err := db.ExecPreparedContext(ctx, db.dialect.AddColumn(name, col[0], col[1])); err != nil {
+				return err
+			}
+			util.Log(F("Added column '%s.%s'", name, col[0]))
+		}
+	}
+	return nil
+}
+
+func (db *DbProxy) DoesTableExist(table string) bool {
+	b, _ := db.DoesTableExistE(table)
+	return b
+}
+
+func (db *DbProxy) DoesTableExistE(table string) (bool, error) {
+	return db.DoesTableExistContext(context.Background(), table)
+}
+
+func (db *DbProxy) DoesTableExistContext(ctx context.Context, table string) (bool, error) {
+	query, args := db.dialect.TableExists(table)
+	q, err := db.QueryPreparedContext(ctx, false, query, args...)
+	if err != nil {
+		return false, err
+	}
+	defer q.Close()
+	return q.Next(), q.Err()
+}
+
+func (db *DbProxy) QueryColumnList(table string) []string {
+	result, _ := db.QueryColumnListE(table)
+	return result
+}
+
+func (db *DbProxy) QueryColumnListE(table string) ([]string, error) {
+	return db.QueryColumnListContext(context.Background(), table)
+}
+
+func (db *DbProxy) QueryColumnListContext(ctx context.Context, table string) ([]string, error) {
+	var result []string
+	query, args := db.dialect.ColumnList(table)
+	rows, err := db.QueryPreparedContext(ctx, false, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var v string
+		if err := rows.Scan(&v); err != nil {
+			return nil, err
+		}
+		result = append(result, v)
+	}
+	return result, rows.Err()
+}
+
+func (db *DbProxy) QueryNextID(table string) int64 {
+	id, _ := db.QueryNextIDE(table)
+	return id
+}
+
+func (db *DbProxy) QueryNextIDE(table string) (int64, error) {
+	return db.QueryNextIDContext(context.Background(), table)
+}
+
+func (db *DbProxy) QueryNextIDContext(ctx context.Context, table string) (int64, error) {
+	result := int64(0)
+	rows, err := db.Build().Se("id").Fr(table).Or("id", "desc").Lm(1).ExeContext(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		if err := rows.Scan(&result); err != nil {
+			return 0, err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	return result + 1, nil
+}
+
+func (db *DbProxy) QueryPrepared(modify bool, q string, args ...interface{}) *sql.Rows {
+	rows, _ := db.QueryPreparedE(modify, q, args...)
+	return rows
+}
+
+// QueryPreparedE is QueryPrepared but reports the errors from Prepare, Exec, and Query.
+func (db *DbProxy) QueryPreparedE(modify bool, q string, args ...interface{}) (*sql.Rows, error) {
+	return db.QueryPreparedContext(context.Background(), modify, q, args...)
+}
+
+func (db *DbProxy) QueryPreparedContext(ctx context.Context, modify bool, q string, args ...interface{}) (*sql.Rows, error) {
+	if modify {
+		_, err := db.ExecPreparedContext(ctx, q, args...)
+		return nil, err
+	}
+	// database/sql prepares and closes the statement itself once rows is closed
+	return db.conn().QueryContext(ctx, q, args...)
+}
+
+// ExecPreparedE runs a statement that does not return rows and reports its result.
+func (db *DbProxy) ExecPreparedE(q string, args ...interface{}) (sql.Result, error) {
+	return db.ExecPreparedContext(context.Background(), q, args...)
+}
+
+func (db *DbProxy) ExecPreparedContext(ctx context.Context, q string, args ...interface{}) (sql.Result, error) {
+	stmt, err := db.conn().PrepareContext(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+	return stmt.ExecContext(ctx, args...)
+}
+
+func (db *DbProxy) DropTable(name string) {
+	db.DropTableE(name)
+}
+
+func (db *DbProxy) DropTableE(name string) error {
+	return db.DropTableContext(context.Background(), name)
+}
+
+func (db *DbProxy) DropTableContext(ctx context.Context, name string) error {
+	_, err := db.ExecPreparedContext(ctx, db.dialect.DropTable(name))
+	return err
+}
+
+func (db *DbProxy) QueryRowCount(table string) int64 {
+	c, err := db.QueryRowCountE(table)
+	if err != nil {
+		return -1
+	}
+	return c
+}
+
+func (db *DbProxy) QueryRowCountE(table string) (int64, error) {
+	return db.QueryRowCountContext(context.Background(), table)
+}
+
+func (db *DbProxy) QueryRowCountContext(ctx context.Context, table string) (int64, error) {
+	c, err := db.Build().Fr(table).CountContext(ctx)
+	if err != nil {
+		return -1, err
+	}
+	return c, nil
+}
+
+// containsFold is stringsu.Contains ignoring case, like column names in all three backends.
+func containsFold(stack []string, needle string) bool {
+	for _, item := range stack {
+		if strings.EqualFold(item, needle) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,119 @@
+package dbstorage
+
+import (
+	"context"
+	"reflect"
+
+	. "github.com/nektro/go-util/alias"
+)
+
+// Repository reads and writes the rows of one table as T, a struct with fields tagged the same way
+// as for CreateTableStruct and an id field tagged `json:"id"`.
+type Repository[T any] struct {
+	db    Database
+	table string
+}
+
+// NewRepository creates or updates table to hold T, like CreateTableStruct, and returns a Repository for it.
+func NewRepository[T any](db Database, table string) (*Repository[T], error) {
+	return NewRepositoryContext[T](context.Background(), db, table)
+}
+
+func NewRepositoryContext[T any](ctx context.Context, db Database, table string) (*Repository[T], error) {
+	var t T
+	if reflect.TypeOf(t) == nil || reflect.TypeOf(t).Kind() != reflect.Struct {
+		return nil, E(F("dbstorage: repository rows must be a struct, got %T", t))
+	}
+	if err := db.CreateTableStructContext(ctx, table, t); err != nil {
+		return nil, err
+	}
+	return &Repository[T]{db, table}, nil
+}
+
+// Table is the name of the table r reads and writes.
+func (r *Repository[T]) Table() string {
+	return r.table
+}
+
+func (r *Repository[T]) Create(v *T) error {
+	return r.CreateContext(context.Background(), v)
+}
+
+// CreateContext inserts v. A zero integer id is generated by the database and a blank string id is a new
+// UUIDv7, either way it is stored back into v.
+func (r *Repository[T]) CreateContext(ctx context.Context, v *T) error {
+	rv := reflect.ValueOf(v).Elem()
+	sf, ok := structField(rv.Type(), "id")
+	if !ok {
+		return E(F("dbstorage: %T has no id field", v))
+	}
+	id := rv.FieldByIndex(sf.Index)
+	switch {
+	case id.Kind() >= reflect.Int && id.Kind() <= reflect.Int64 && id.Int() == 0:
+		_, err := r.db.Build().InsIDContext(ctx, r.table, v)
+		return err
+	case id.Kind() == reflect.String && id.Len() == 0:
+		s, err := NewUUIDv7().NextStringID(ctx, r.table)
+		if err != nil {
+			return err
+		}
+		id.SetString(s)
+	}
+	_, err := r.db.Build().InsI(r.table, v).ExecContext(ctx)
+	return err
+}
+
+func (r *Repository[T]) Get(id interface{}) (T, error) {
+	return r.GetContext(context.Background(), id)
+}
+
+// GetContext is the row with the given id, or sql.ErrNoRows if there is none.
+func (r *Repository[T]) GetContext(ctx context.Context, id interface{}) (T, error) {
+	return GetContext[T](ctx, r.db, r.table, id)
+}
+
+func (r *Repository[T]) List(filter ...Cond) ([]T, error) {
+	return r.ListContext(context.Background(), filter...)
+}
+
+// ListContext is every row matching all of filter, ordered by id.
+func (r *Repository[T]) ListContext(ctx context.Context, filter ...Cond) ([]T, error) {
+	return AllContext[T](ctx, r.db.Build().Se("*").Fr(r.table).Where(filter...).Or("id", "asc"))
+}
+
+func (r *Repository[T]) Update(v *T, cols ...string) error {
+	return r.UpdateContext(context.Background(), v, cols...)
+}
+
+// UpdateContext saves the fields of v to the row with its id, or only those named in cols if there are any.
+func (r *Repository[T]) UpdateContext(ctx context.Context, v *T, cols ...string) error {
+	_, err := r.db.Build().UpI(r.table, v, cols...).ExecContext(ctx)
+	return err
+}
+
+func (r *Repository[T]) Delete(id interface{}) error {
+	return r.DeleteContext(context.Background(), id)
+}
+
+func (r *Repository[T]) DeleteContext(ctx context.Context, id interface{}) error {
+	_, err := r.db.Build().Del(r.table).WhV("id", id).ExecContext(ctx)
+	return err
+}
+
+func (r *Repository[T]) Count(filter ...Cond) (int64, error) {
+	return r.CountContext(context.Background(), filter...)
+}
+
+// CountContext is the number of rows matching all of filter.
+func (r *Repository[T]) CountContext(ctx context.Context, filter ...Cond) (int64, error) {
+	return r.db.Build().Fr(r.table).Where(filter...).CountContext(ctx)
+}
+
+func (r *Repository[T]) Exists(id interface{}) (bool, error) {
+	return r.ExistsContext(context.Background(), id)
+}
+
+func (r *Repository[T]) ExistsContext(ctx context.Context, id interface{}) (bool, error) {
+	n, err := r.CountContext(ctx, Eq("id", id))
+	return n > 0, err
+}
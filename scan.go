@@ -0,0 +1,260 @@
+package dbstorage
+
+import (
+	"context"
+	"database/sql"
+	"iter"
+	"reflect"
+	"strings"
+	"sync"
+
+	. "github.com/nektro/go-util/alias"
+)
+
+// structColumnsCache holds the column to field index mapping of each struct type ScanRow has seen.
+var structColumnsCache sync.Map
+
+// ScanRow scans the current row of rows into the struct pointed to by dest, matching each column to
+// the field whose json tag names it, ignoring case. Columns without a field are discarded. Fields are
+// scanned the same way as rows.Scan would, so they may be sql.Scanner's, and NULL columns need a
+// pointer or sql.Null field.
+func ScanRow(rows *sql.Rows, dest interface{}) error {
+	v := reflect.ValueOf(dest)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		return E(F("dbstorage: expected a pointer to a struct, got %T", dest))
+	}
+	v = v.Elem()
+	cols, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+	fields := structFields(v.Type())
+	ptrs := make([]interface{}, len(cols))
+	for i, item := range cols {
+		if index, ok := fields[strings.ToLower(item)]; ok {
+			ptrs[i] = v.FieldByIndex(index).Addr().Interface()
+		} else {
+			ptrs[i] = new(interface{})
+		}
+	}
+	return rows.Scan(ptrs...)
+}
+
+// structFields maps the lowercased json tag name of each field of t to its index.
+func structFields(t reflect.Type) map[string][]int {
+	if m, ok := structColumnsCache.Load(t); ok {
+		return m.(map[string][]int)
+	}
+	m := map[string][]int{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := strings.Split(f.Tag.Get("json"), ",")[0]
+		if len(name) == 0 || name == "-" || f.PkgPath != "" {
+			continue
+		}
+		m[strings.ToLower(name)] = f.Index
+	}
+	structColumnsCache.Store(t, m)
+	return m
+}
+
+// exeRows runs qb for its rows, which a modify query only has with Returning.
+func exeRows(ctx context.Context, qb QueryBuilder) (*sql.Rows, error) {
+	rows, err := qb.ExeContext(ctx)
+	if err == nil && rows == nil {
+		return nil, E("dbstorage: the query returned no rows to scan, a modify query needs Returning")
+	}
+	return rows, err
+}
+
+// ScanAllInto scans every row from the QueryBuilder into the slice pointed to by dest, whose elements
+// are structs or pointers to structs.
+func ScanAllInto(qb QueryBuilder, dest interface{}) error {
+	return ScanAllIntoContext(context.Background(), qb, dest)
+}
+
+func ScanAllIntoContext(ctx context.Context, qb QueryBuilder, dest interface{}) error {
+	v := reflect.ValueOf(dest)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Slice {
+		return E(F("dbstorage: expected a pointer to a slice, got %T", dest))
+	}
+	s := v.Elem()
+	et := s.Type().Elem()
+	isPtr := et.Kind() == reflect.Ptr
+	if isPtr {
+		et = et.Elem()
+	}
+	rows, err := exeRows(ctx, qb)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		item := reflect.New(et)
+		if err := ScanRow(rows, item.Interface()); err != nil {
+			return err
+		}
+		if isPtr {
+			s.Set(reflect.Append(s, item))
+		} else {
+			s.Set(reflect.Append(s, item.Elem()))
+		}
+	}
+	return rows.Err()
+}
+
+// ScanFirstInto scans the first row from the QueryBuilder into the struct pointed to by dest, then closes
+// the query. It returns sql.ErrNoRows if there are none.
+func ScanFirstInto(qb QueryBuilder, dest interface{}) error {
+	return ScanFirstIntoContext(context.Background(), qb, dest)
+}
+
+func ScanFirstIntoContext(ctx context.Context, qb QueryBuilder, dest interface{}) error {
+	rows, err := exeRows(ctx, qb)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		return sql.ErrNoRows
+	}
+	return ScanRow(rows, dest)
+}
+
+// ErrTooManyRows is returned by One and Get when more than one row matches.
+var ErrTooManyRows = E("dbstorage: expected one row, got more")
+
+// scanT scans the current row of rows into a new T. If T, or *T when T is a pointer, is Scannable
+// its Scan is used, otherwise it is filled in by ScanRow.
+func scanT[T any](rows *sql.Rows) (T, error) {
+	var result T
+	rt := reflect.TypeOf(&result).Elem()
+	if rt.Kind() == reflect.Ptr {
+		result = reflect.New(rt.Elem()).Interface().(T)
+	}
+	if s, ok := any(result).(Scannable); ok {
+		t, ok := s.Scan(rows).(T)
+		if !ok {
+			return result, E(F("dbstorage: Scan of %T did not return a %T", result, result))
+		}
+		return t, nil
+	}
+	if rt.Kind() == reflect.Ptr {
+		return result, ScanRow(rows, result)
+	}
+	return result, ScanRow(rows, &result)
+}
+
+// Rows streams each row from the QueryBuilder as a T without buffering them. The query is closed when the
+// loop ends or breaks. An error from the query, a scan, or rows.Err is yielded with the zero T and ends the loop.
+func Rows[T any](ctx context.Context, qb QueryBuilder) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		var zero T
+		rows, err := exeRows(ctx, qb)
+		if err != nil {
+			yield(zero, err)
+			return
+		}
+		defer rows.Close()
+		for rows.Next() {
+			t, err := scanT[T](rows)
+			if err != nil {
+				yield(zero, err)
+				return
+			}
+			if !yield(t, nil) {
+				return
+			}
+		}
+		if err := rows.Err(); err != nil {
+			yield(zero, err)
+		}
+	}
+}
+
+// streamT calls f with each row from the QueryBuilder as a T, like ScanStream, until f returns false.
+func streamT[T any](ctx context.Context, qb QueryBuilder, f func(T) bool) error {
+	for t, err := range Rows[T](ctx, qb) {
+		if err != nil {
+			return err
+		}
+		if !f(t) {
+			return nil
+		}
+	}
+	return nil
+}
+
+// All scans every row from the QueryBuilder into a T.
+func All[T any](qb QueryBuilder) ([]T, error) {
+	return AllContext[T](context.Background(), qb)
+}
+
+func AllContext[T any](ctx context.Context, qb QueryBuilder) ([]T, error) {
+	result := []T{}
+	err := streamT(ctx, qb, func(t T) bool {
+		result = append(result, t)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// First scans the first row from the QueryBuilder into a T. It returns sql.ErrNoRows if there are none.
+func First[T any](qb QueryBuilder) (T, error) {
+	return FirstContext[T](context.Background(), qb)
+}
+
+func FirstContext[T any](ctx context.Context, qb QueryBuilder) (T, error) {
+	var result T
+	found := false
+	err := streamT(ctx, qb, func(t T) bool {
+		result, found = t, true
+		return false
+	})
+	if err == nil && !found {
+		err = sql.ErrNoRows
+	}
+	return result, err
+}
+
+// One scans the only row from the QueryBuilder into a T. It returns sql.ErrNoRows if there are none
+// and ErrTooManyRows if there is more than one.
+func One[T any](qb QueryBuilder) (T, error) {
+	return OneContext[T](context.Background(), qb)
+}
+
+func OneContext[T any](ctx context.Context, qb QueryBuilder) (T, error) {
+	var result T
+	n := 0
+	err := streamT(ctx, qb, func(t T) bool {
+		result = t
+		n++
+		return n < 2
+	})
+	if err != nil {
+		return result, err
+	}
+	switch n {
+	case 0:
+		return result, sql.ErrNoRows
+	case 1:
+		return result, nil
+	}
+	var zero T
+	return zero, ErrTooManyRows
+}
+
+// Get scans the row of table with the given id into a T. db is a Database or a Tx.
+func Get[T any](db interface{ Build() QueryBuilder }, table string, id interface{}) (T, error) {
+	return GetContext[T](context.Background(), db, table, id)
+}
+
+func GetContext[T any](ctx context.Context, db interface{ Build() QueryBuilder }, table string, id interface{}) (T, error) {
+	return OneContext[T](ctx, db.Build().Se("*").Fr(table).WhV("id", id))
+}
@@ -1,29 +1,18 @@
 package dbstorage
 
 import (
-	"bytes"
+	"context"
 	"database/sql"
-	"database/sql/driver"
 	"errors"
-	"fmt"
 	"net/url"
 	"reflect"
-	"runtime/debug"
-	"strconv"
 	"strings"
 	"time"
 
-	"github.com/nektro/go-util/arrays/stringsu"
-	"github.com/nektro/go-util/util"
-
 	_ "github.com/mattn/go-sqlite3"
 	. "github.com/nektro/go-util/alias"
 )
 
-type DbProxy struct {
-	db *sql.DB
-}
-
 type PragmaTableInfo struct {
 	CID        int
 	Name       string
@@ -38,7 +27,8 @@ func ConnectSqlite(path string) (Database, error) {
 	op.Add("mode", "rwc")
 	op.Add("cache", "shared")
 	op.Add("_busy_timeout", "5000")
-	op.Add("_journal_mode", "OFF")
+	// rolling back needs a journal, keep it in memory instead of turning it off
+	op.Add("_journal_mode", "MEMORY")
 	db, err := sql.Open("sqlite3", "file:"+path+"?"+op.Encode())
 	if err != nil {
 		return nil, errors.New("sqlite: sql.Open: " + err.Error())
@@ -46,287 +36,137 @@ func ConnectSqlite(path string) (Database, error) {
 	db.SetMaxOpenConns(1)
 	db.SetMaxIdleConns(0)
 	db.SetConnMaxLifetime(time.Second)
-	return &Outer{&DbProxy{db}}, db.Ping()
+	return &Outer{&DbProxy{db: db, dialect: sqliteDialect{}}}, db.Ping()
 }
 
-func (db *DbProxy) Ping() error {
-	return db.db.Ping()
-}
-
-func (db *DbProxy) Close() error {
-	return db.db.Close()
-}
-
-func (db *DbProxy) DB() *sql.DB {
-	return db.db
-}
-
-func (db *DbProxy) DriverName() string {
-	return "sqlite"
-}
-
-func (db *DbProxy) TagName() string {
-	return "sqlite"
-}
-
-func (db *DbProxy) IntPrimaryKey() string {
-	return "bigint primary key"
+func (db *DbProxy) QueryTableInfo(table string) []PragmaTableInfo {
+	result, _ := db.QueryTableInfoE(table)
+	return result
 }
 
-func (db *DbProxy) TypeForType(t reflect.Type) string {
-	switch t.Name() {
-	case "string":
-		return "text"
-	case "int", "int8", "int16", "int32", "int64":
-		return "int"
-	case "bool":
-		return "tinyint"
-	}
-	dv, ok := reflect.New(t).Interface().(driver.Valuer)
-	if ok {
-		v, _ := dv.Value()
-		return db.TypeForType(reflect.TypeOf(v))
-	}
-	return ""
+func (db *DbProxy) QueryTableInfoE(table string) ([]PragmaTableInfo, error) {
+	return db.QueryTableInfoContext(context.Background(), table)
 }
 
-func (db *DbProxy) CreateTable(name string, pk []string, columns [][]string) {
-	if !db.DoesTableExist(name) {
-		db.QueryPrepared(true, F("create table %s(%s %s)", name, pk[0], pk[1]))
-		util.Log(F("Created table '%s'", name))
+// QueryTableInfoContext is the pragma_table_info of table, only SQLite has it.
+func (db *DbProxy) QueryTableInfoContext(ctx context.Context, table string) ([]PragmaTableInfo, error) {
+	if _, ok := db.dialect.(sqliteDialect); !ok {
+		return nil, errors.New("dbstorage: QueryTableInfo is only supported by sqlite, not " + db.dialect.DriverName())
 	}
-	pti := db.QueryColumnList(name)
-	for _, col := range columns {
-		if !stringsu.Contains(pti, col[0]) {
-			db.QueryPrepared(true, F("alter table %s add %s %s", name, col[0], col[1]))
-			util.Log(F("Added column '%s.%s'", name, col[0]))
-		}
-	}
-}
-
-func (db *DbProxy) DoesTableExist(table string) bool {
-	q := db.QueryPrepared(false, F("select name from sqlite_master where type='table' AND name='%s';", table))
-	defer q.Close()
-	return q.Next()
-}
-
-func (db *DbProxy) QueryTableInfo(table string) []PragmaTableInfo {
 	var result []PragmaTableInfo
-	rows := db.QueryPrepared(false, F("pragma table_info(%s)", table))
+	rows, err := db.QueryPreparedContext(ctx, false, `select cid, name, type, "notnull", dflt_value, pk from pragma_table_info(?)`, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
 	for rows.Next() {
 		var v PragmaTableInfo
-		rows.Scan(&v.CID, &v.Name, &v.Type, &v.NotNull, &v.HasDefault, &v.HasPK)
+		var dflt sql.NullString
+		if err := rows.Scan(&v.CID, &v.Name, &v.Type, &v.NotNull, &dflt, &v.HasPK); err != nil {
+			return nil, err
+		}
+		v.HasDefault = dflt.Valid
 		result = append(result, v)
 	}
-	rows.Close()
-	return result
+	return result, rows.Err()
 }
 
-func (db *DbProxy) QueryColumnList(table string) []string {
-	var result []string
-	for _, item := range db.QueryTableInfo(table) {
-		result = append(result, item.Name)
-	}
-	return result
-}
+//
+//
 
-func (db *DbProxy) QueryNextID(table string) int64 {
-	result := int64(0)
-	rows := db.QueryPrepared(false, F("select id from %s order by id desc limit 1", table))
-	for rows.Next() {
-		rows.Scan(&result)
-	}
-	rows.Close()
-	return result + 1
-}
+type sqliteDialect struct{}
 
-func (db *DbProxy) QueryPrepared(modify bool, q string, args ...interface{}) *sql.Rows {
-	stmt, err := db.db.Prepare(q)
-	if err != nil {
-		return nil
-	}
-	if modify {
-		stmt.Exec(args...)
-		return nil
-	}
-	rows, _ := stmt.Query(args...)
-	if err != nil {
-		return nil
-	}
-	return rows
+func (sqliteDialect) DriverName() string {
+	return "sqlite"
 }
 
-func (db *DbProxy) DropTable(name string) {
-	db.QueryPrepared(true, "drop table if exists "+name)
+func (sqliteDialect) TagName() string {
+	return "sqlite"
 }
 
-func (db *DbProxy) QueryRowCount(table string) int64 {
-	rows := db.Build().Se("count(*)").Fr(table).Exe()
-	if rows == nil {
-		return -1
-	}
-	defer rows.Close()
-	c := int64(0)
-	rows.Next()
-	rows.Scan(&c)
-	return c
+func (sqliteDialect) Placeholder(n int) string {
+	return "?"
 }
 
-//
-
-//
+func (sqliteDialect) BackslashEscapes() bool {
+	return false
+}
 
-type sQueryBuilder struct {
-	d *DbProxy       // db
-	q string         // query string
-	v []driver.Value // values
-	m bool           // modify
-	w [][4]string    // where's
-	o [][2]string    // order's
-	l int64          // limit
-	f int64          // offset
+func (sqliteDialect) QuoteIdent(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
 }
 
-func (db *DbProxy) Build() QueryBuilder {
-	qb := new(sQueryBuilder)
-	qb.d = db
-	return qb
+func (sqliteDialect) IntPrimaryKey() string {
+	return "bigint primary key"
 }
 
-func (qb *sQueryBuilder) Se(cols string) QueryBuilder {
-	qb.m = false
-	qb.q = qb.q + "select " + cols
-	return qb
+func (sqliteDialect) AutoIncrementPrimaryKey() string {
+	return "integer primary key autoincrement"
 }
 
-func (qb *sQueryBuilder) Fr(table string) QueryBuilder {
-	qb.q = qb.q + " from " + table
-	return qb
+func (sqliteDialect) UUIDPrimaryKey() string {
+	return "text primary key"
 }
 
-func (qb *sQueryBuilder) WR(col string, op string, value string, raw bool, ags ...interface{}) QueryBuilder {
-	qb.w = append(qb.w, [4]string{col, op, value, strconv.FormatBool(raw)})
-	for _, item := range ags {
-		o, _ := driver.DefaultParameterConverter.ConvertValue(item)
-		qb.v = append(qb.v, o)
+func (d sqliteDialect) TypeForType(t reflect.Type) string {
+	switch t.Name() {
+	case "string":
+		return "text"
+	case "int", "int8", "int16", "int32", "int64":
+		return "int"
+	case "bool":
+		return "tinyint"
 	}
-	return qb
+	return typeForValuer(d, t)
 }
 
-func (qb *sQueryBuilder) Wr(col string, op string, value string) QueryBuilder {
-	qb.WR(col, op, value, false)
-	return qb
+func (d sqliteDialect) CreateTable(name string, pk string, pkType string) string {
+	return F("create table %s(%s %s)", d.QuoteIdent(name), d.QuoteIdent(pk), pkType)
 }
 
-func (qb *sQueryBuilder) Wh(col string, value string) QueryBuilder {
-	qb.Wr(col, "=", value)
-	return qb
+func (d sqliteDialect) AddColumn(table string, col string, typ string) string {
+	return F("alter table %s add %s %s", d.QuoteIdent(table), d.QuoteIdent(col), typ)
 }
 
-func (qb *sQueryBuilder) Or(col string, order string) QueryBuilder {
-	qb.o = append(qb.o, [2]string{col, order})
-	return qb
+func (d sqliteDialect) DropTable(name string) string {
+	return "drop table if exists " + d.QuoteIdent(name)
 }
 
-func (qb *sQueryBuilder) Lm(limit int64) QueryBuilder {
-	qb.l = limit
-	return qb
+func (sqliteDialect) TableExists(table string) (string, []interface{}) {
+	return "select name from sqlite_master where type='table' AND name=?", []interface{}{table}
 }
 
-func (qb *sQueryBuilder) Of(offset int64) QueryBuilder {
-	qb.f = offset
-	return qb
+func (sqliteDialect) ColumnList(table string) (string, []interface{}) {
+	return "select name from pragma_table_info(?)", []interface{}{table}
 }
 
-func (qb *sQueryBuilder) Exe() *sql.Rows {
-	vals := []string{}
-	for _, item := range qb.v {
-		if b, ok := item.(bool); ok {
-			vals = append(vals, strconv.Itoa(util.Btoi(b)))
-			continue
-		}
-		vals = append(vals, fmt.Sprintf("%v", item))
-	}
-	for i, item := range qb.w {
-		if item[3] == "false" {
-			if i == 0 {
-				qb.q += " where " + item[0] + " " + item[1] + " ?"
-			} else {
-				qb.q += " and " + item[0] + " " + item[1] + " ?"
-			}
-			vals = append(vals, item[2])
-		} else {
-			if i == 0 {
-				qb.q += " where " + item[0] + " " + item[1] + " " + item[2]
-			} else {
-				qb.q += " and " + item[0] + " " + item[1] + " " + item[2]
-			}
-		}
-	}
-	for i, item := range qb.o {
-		if i == 0 {
-			qb.q += " order by " + item[0] + " " + item[1]
-		} else {
-			qb.q += ", " + item[0] + " " + item[1]
-		}
-	}
-	if qb.l > 0 {
-		qb.q += " limit " + strconv.FormatInt(qb.l, 10)
+func (sqliteDialect) Savepoint(name string) (string, string, string) {
+	return "savepoint " + name, "release savepoint " + name, "rollback to savepoint " + name
+}
 
-		if qb.f > 0 {
-			qb.q += " offset " + strconv.FormatInt(qb.f, 10)
-		}
-	}
-	iva := make([]interface{}, len(vals))
-	for i, v := range vals {
-		iva[i] = v
-	}
-	if StatementDebug {
-		st := bytes.Split(debug.Stack(), []byte("\n"))
-		for _, item := range st {
-			if item[0] != '\t' {
-				continue
-			}
-			if bytes.Contains(item, []byte("src/runtime/debug")) || bytes.Contains(item, []byte("github.com/nektro/go.dbstorage")) {
-				continue
-			}
-			fmt.Println("---", string(item[1:]), "\t", "-", qb.q)
-			break
-		}
-	}
-	return qb.d.QueryPrepared(qb.m, qb.q, iva...)
+// MaxParams is the default of SQLITE_MAX_VARIABLE_NUMBER before 3.32.0, newer builds allow 32766.
+func (sqliteDialect) MaxParams() int {
+	return 999
 }
 
-func (qb *sQueryBuilder) Up(table string, col string, value string) QueryBuilder {
-	qb.m = true
-	qb.q = qb.q + "update " + table + " set " + col + " = ?"
-	qb.v = append(qb.v, value)
-	return qb
+func (sqliteDialect) LastInsertID() bool {
+	return true
 }
 
-func (qb *sQueryBuilder) Ins(table string, values ...interface{}) Executable {
-	qb.m = true
-	qb.q = qb.q + "insert into " + table + " values (" + strings.Join(strings.Split(strings.Repeat("?", len(values)), ""), ",") + ")"
-	for _, item := range values {
-		o, _ := driver.DefaultParameterConverter.ConvertValue(item)
-		qb.v = append(qb.v, o)
-	}
-	return qb
+// Returning needs SQLite 3.35.0 or later.
+func (sqliteDialect) Returning() bool {
+	return true
 }
 
-func (qb *sQueryBuilder) InsI(table string, strct interface{}) Executable {
-	v := reflect.ValueOf(strct).Elem()
-	t := v.Type()
-	atrs := []interface{}{}
-	for i := 0; i < t.NumField(); i++ {
-		sv := v.Field(i).Interface()
-		atrs = append(atrs, sv)
-	}
-	return qb.Ins(table, atrs...)
+// Upsert needs SQLite 3.24.0 or later.
+func (sqliteDialect) Upsert(conflict []string, update []string) (string, string) {
+	return "insert into", onConflict(conflict, update)
+}
+
+func (sqliteDialect) RowValues() bool {
+	return false
 }
 
-func (qb *sQueryBuilder) Del(table string) QueryBuilder {
-	qb.m = true
-	qb.q = "delete from " + table
-	return qb
+func (sqliteDialect) ILike(col string, value string, escape bool) string {
+	return col + " like " + value + " collate nocase" + likeEscape(escape)
 }
@@ -1,28 +1,67 @@
 package dbstorage
 
 import (
+	"context"
 	"database/sql"
 )
 
 type QueryBuilder interface {
 	Se(cols string) QueryBuilder
 	Fr(tabls string) QueryBuilder
+	Join(table string, on ...Cond) QueryBuilder
+	LeftJoin(table string, on ...Cond) QueryBuilder
+	RightJoin(table string, on ...Cond) QueryBuilder
+	CrossJoin(table string) QueryBuilder
 	WR(col string, op string, value string, raw bool, ags ...interface{}) QueryBuilder
 	Wr(col string, op string, value string) QueryBuilder
 	Wh(col string, value string) QueryBuilder
+	WrV(col string, op string, value interface{}) QueryBuilder
+	WhV(col string, value interface{}) QueryBuilder
+	Where(conds ...Cond) QueryBuilder
+	WhereAny(conds ...Cond) QueryBuilder
+	WhereAll(conds ...Cond) QueryBuilder
+	GroupBy(cols ...string) QueryBuilder
+	Having(conds ...Cond) QueryBuilder
 	Or(col string, order string) QueryBuilder
 	Lm(limit int64) QueryBuilder
 	Of(offset int64) QueryBuilder
 	Up(table string, col string, value string) QueryBuilder
+	UpV(table string, col string, value interface{}) QueryBuilder
+	Set(col string, value interface{}) QueryBuilder
+	UpI(table string, strct interface{}, cols ...string) QueryBuilder
+	UpINZ(table string, strct interface{}) QueryBuilder
 	Ins(table string, values ...interface{}) Executable
 	InsI(table string, strct interface{}) Executable
+	InsID(table string, strct interface{}) (int64, error)
+	InsIDContext(ctx context.Context, table string, strct interface{}) (int64, error)
+	InsMany(table string, rows interface{}) (int64, error)
+	InsManyContext(ctx context.Context, table string, rows interface{}) (int64, error)
+	CopyMany(table string, rows interface{}) (int64, error)
+	CopyManyContext(ctx context.Context, table string, rows interface{}) (int64, error)
+	Upsert(table string, strct interface{}, conflictCols []string, updateCols []string) Executable
+	InsIgnore(table string, strct interface{}) Executable
 	Del(table string) QueryBuilder
+	Returning(cols ...string) QueryBuilder
+	Count() (int64, error)
+	CountContext(ctx context.Context) (int64, error)
+	Sum(col string) (float64, error)
+	SumContext(ctx context.Context, col string) (float64, error)
+	Avg(col string) (float64, error)
+	AvgContext(ctx context.Context, col string) (float64, error)
+	Min(col string, dest interface{}) error
+	MinContext(ctx context.Context, col string, dest interface{}) error
+	Max(col string, dest interface{}) error
+	MaxContext(ctx context.Context, col string, dest interface{}) error
 	Executable
 }
 
 // Executable is any object who represents a query that can be called on to produce a sql.Rows
 type Executable interface {
 	Exe() *sql.Rows
+	ExeE() (*sql.Rows, error)
+	ExecE() (sql.Result, error)
+	ExeContext(ctx context.Context) (*sql.Rows, error)
+	ExecContext(ctx context.Context) (sql.Result, error)
 }
 
 // Scannable can take in Rows and return an object
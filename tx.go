@@ -0,0 +1,132 @@
+package dbstorage
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+)
+
+// Tx is an open transaction. Queries built from it all run on the same *sql.Tx.
+// Calling Begin on a Tx starts a nested transaction backed by a savepoint.
+type Tx interface {
+	Build() QueryBuilder
+	QueryNextID(table string) int64
+	QueryNextIDE(table string) (int64, error)
+	QueryNextIDContext(ctx context.Context, table string) (int64, error)
+	QueryRowCount(table string) int64
+	QueryRowCountE(table string) (int64, error)
+	QueryRowCountContext(ctx context.Context, table string) (int64, error)
+	Tx() *sql.Tx
+	Begin() (Tx, error)
+	BeginContext(ctx context.Context) (Tx, error)
+	WithTx(f func(Tx) error) error
+	Commit() error
+	Rollback() error
+}
+
+// preparer is satisfied by both *sql.DB and *sql.Tx.
+type preparer interface {
+	PrepareContext(ctx context.Context, query string) (*sql.Stmt, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+type txOuter struct {
+	Inner
+	tx *sql.Tx
+	sp string // savepoint name, empty for the outermost transaction
+	n  *int   // savepoints created so far on tx
+}
+
+func newTxOuter(inner Inner, tx *sql.Tx) *txOuter {
+	return &txOuter{inner, tx, "", new(int)}
+}
+
+func (t *txOuter) Tx() *sql.Tx {
+	return t.tx
+}
+
+func (t *txOuter) Begin() (Tx, error) {
+	return t.BeginContext(context.Background())
+}
+
+func (t *txOuter) BeginContext(ctx context.Context) (Tx, error) {
+	*t.n++
+	name := "dbstorage_sp_" + strconv.Itoa(*t.n)
+	create, _, _ := t.Dialect().Savepoint(name)
+	if _, err := t.tx.ExecContext(ctx, create); err != nil {
+		return nil, err
+	}
+	return &txOuter{t.Inner, t.tx, name, t.n}, nil
+}
+
+func (t *txOuter) WithTx(f func(Tx) error) error {
+	tx, err := t.Begin()
+	if err != nil {
+		return err
+	}
+	return runTx(tx, f)
+}
+
+func (t *txOuter) Commit() error {
+	if len(t.sp) == 0 {
+		return t.tx.Commit()
+	}
+	_, release, _ := t.Dialect().Savepoint(t.sp)
+	_, err := t.tx.Exec(release)
+	return err
+}
+
+func (t *txOuter) Rollback() error {
+	if len(t.sp) == 0 {
+		return t.tx.Rollback()
+	}
+	_, release, rollback := t.Dialect().Savepoint(t.sp)
+	if _, err := t.tx.Exec(rollback); err != nil {
+		return err
+	}
+	_, err := t.tx.Exec(release)
+	return err
+}
+
+// WithTx runs f inside a new transaction. The transaction is committed if f returns nil and rolled back otherwise.
+func (db *Outer) WithTx(f func(Tx) error) error {
+	return db.WithTxContext(context.Background(), nil, f)
+}
+
+func (db *Outer) WithTxContext(ctx context.Context, opts *sql.TxOptions, f func(Tx) error) error {
+	tx, err := db.BeginTx(ctx, opts)
+	if err != nil {
+		return err
+	}
+	return runTx(tx, f)
+}
+
+// inTx runs f with a DbProxy in a transaction, db itself if it already is one.
+func (db *DbProxy) inTx(ctx context.Context, f func(*DbProxy) error) error {
+	if db.tx != nil {
+		return f(db)
+	}
+	tx, err := db.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := f(&DbProxy{db.db, tx, db.dialect}); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func runTx(tx Tx, f func(Tx) error) error {
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		}
+	}()
+	if err := f(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}